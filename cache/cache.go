@@ -10,6 +10,7 @@ import (
 	"go.starlark.net/starlark"
 
 	"github.com/mbark/sindr/internal/logger"
+	"github.com/mbark/sindr/internal/trace"
 )
 
 var GlobalCache diskCache
@@ -105,7 +106,7 @@ func (c *Cache) diff(
 		return nil, err
 	}
 
-	isDiff, err := checkIfDiff(logger.WithStack(thread.CallStack()), c.diskCache, *options)
+	isDiff, err := checkIfDiff(thread, c.diskCache, *options)
 	if err != nil {
 		return nil, err
 	}
@@ -188,7 +189,7 @@ func (c *Cache) withVersion(
 		return nil, err
 	}
 
-	isDiff, err := checkIfDiff(logger.WithStack(thread.CallStack()), c.diskCache, *options)
+	isDiff, err := checkIfDiff(thread, c.diskCache, *options)
 	if err != nil {
 		return nil, err
 	}
@@ -207,28 +208,21 @@ func (c *Cache) withVersion(
 	return starlark.Bool(true), nil
 }
 
-func checkIfDiff(logger logger.Interface, cache diskCache, options cacheDiffOptions) (bool, error) {
+func checkIfDiff(thread *starlark.Thread, cache diskCache, options cacheDiffOptions) (bool, error) {
+	span := trace.Begin(thread, "cache", options.name)
 	currentVersion, err := cache.GetVersion(options.name)
 	if err != nil {
 		return false, err
 	}
 
 	isDiff := currentVersion == nil || *currentVersion != options.version
-	if currentVersion == nil {
-		logger.LogVerbose(
-			cachePrefixStyle.Render("cache:"),
-			cacheNameStyle.Render(options.name),
-			"current not set",
-			cachePrefixStyle.Render("version=")+cacheNameStyle.Render(options.version),
-		)
-	} else {
-		logger.LogVerbose(
-			cachePrefixStyle.Render("cache:"),
-			cacheNameStyle.Render(options.name),
-			cachePrefixStyle.Render("current=")+cacheNameStyle.Render(*currentVersion),
-			cachePrefixStyle.Render("version=")+cacheNameStyle.Render(options.version),
-		)
-	}
+	span.End(map[string]any{"version": options.version, "hit": !isDiff})
+	logger.LogEvent(logger.WithStack(thread.CallStack()), logger.CacheCheck{
+		Name:    options.name,
+		Current: currentVersion,
+		Version: options.version,
+		Hit:     !isDiff,
+	})
 
 	return isDiff, nil
 }
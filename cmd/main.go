@@ -9,7 +9,7 @@ import (
 )
 
 func main() {
-	err := sindr.Run(context.Background(), os.Args)
+	err := sindr.Run(context.Background(), os.Args, sindr.WithTrustCheck(true))
 	if err != nil {
 		logger.LogErr("error running sindr", err)
 	}
@@ -6,8 +6,17 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
 )
 
+// projectConfigKeys are the keys the config next to the Starlark file can set. It comes with the project like the
+// Starlark file, but is read before the Starlark file is trusted, so it can't set anything changing what is run or
+// which files are read, like the shell, the secrets key file or the policy.
+var projectConfigKeys = []string{outputKey, progressKey}
+
 func cacheHome() string {
 	home := os.Getenv("HOME")
 	cacheDir := xdgPath("CACHE_HOME", path.Join(home, ".cache"))
@@ -23,6 +32,34 @@ func xdgPath(name, defaultPath string) string {
 	return defaultPath
 }
 
+// readProjectConfig reads the sindr.{yaml,toml,json} next to the Starlark file in dir, which takes precedence over the
+// user config. It fails if the config sets any other keys than projectConfigKeys.
+func readProjectConfig(v *viper.Viper, dir string) error {
+	p := viper.New()
+	p.SetConfigName("sindr")
+	p.AddConfigPath(dir)
+	err := p.ReadInConfig()
+	if err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if errors.As(err, &notFound) {
+			return nil
+		}
+		return fmt.Errorf("read config: %w", err)
+	}
+	if p.ConfigFileUsed() == v.ConfigFileUsed() {
+		// the Starlark file is in the user config directory
+		return nil
+	}
+
+	for _, key := range p.AllKeys() {
+		key, _, _ = strings.Cut(key, ".")
+		if !slices.Contains(projectConfigKeys, key) {
+			return fmt.Errorf("read config: %s can't set %s, it's only read from the user config", p.ConfigFileUsed(), key)
+		}
+	}
+	return v.MergeConfigMap(p.AllSettings())
+}
+
 func findPathUpdwards(search string) (string, error) {
 	dir, err := os.Getwd()
 	if err != nil {
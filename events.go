@@ -0,0 +1,53 @@
+package sindr
+
+import (
+	"github.com/spf13/viper"
+
+	"github.com/mbark/sindr/internal/logger"
+)
+
+// Event is something that happened while running a command. The handlers added with WithEventHandler are called with
+// each event as it happens, which is one of the event types below.
+type Event = logger.Event
+
+type (
+	// CommandStart is sent when a command is started, with the flags and arguments it was given.
+	CommandStart = logger.CommandStart
+	// CommandEnd is sent when a command has finished, with the error it failed with if any.
+	CommandEnd = logger.CommandEnd
+	// ShellStart is sent when a process is started with shell(), exec(), run(), pipe() or service().
+	ShellStart = logger.ShellStart
+	// ShellOutput is sent for each line a process writes to stdout or stderr.
+	ShellOutput = logger.ShellOutput
+	// ShellEnd is sent when a process has exited.
+	ShellEnd = logger.ShellEnd
+	// CacheCheck is sent when the cache is checked for a version.
+	CacheCheck = logger.CacheCheck
+	// TaskSpawned is sent when a task is started in the background with start(), pool.run() or service().
+	TaskSpawned = logger.TaskSpawned
+	// TaskFinished is sent when a task started in the background has finished.
+	TaskFinished = logger.TaskFinished
+	// Error is sent when something running in the background fails.
+	Error = logger.Error
+
+	// Arg is a flag or argument given to a command.
+	Arg = logger.Arg
+	// Duration is a time.Duration that is marshalled to JSON as a number of milliseconds.
+	Duration = logger.Duration
+)
+
+// The kinds of tasks in TaskSpawned and TaskFinished.
+const (
+	TaskStart   = logger.TaskStart
+	TaskPool    = logger.TaskPool
+	TaskService = logger.TaskService
+)
+
+// WithEventHandler adds a handler that is called with every event as it happens, regardless of how or if it's logged,
+// which allows building metrics, custom UIs or audit trails without parsing logs. Events can happen concurrently, but
+// the handlers are only called with one event at a time, so a slow handler slows down everything running.
+func WithEventHandler(handler func(Event)) RunOption {
+	return func(o *runOptions, v *viper.Viper) {
+		o.eventHandlers = append(o.eventHandlers, handler)
+	}
+}
@@ -0,0 +1,127 @@
+package sindr_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mbark/sindr"
+	"github.com/mbark/sindr/internal/logger"
+	"github.com/mbark/sindr/internal/sindrtest"
+)
+
+func TestEventHandler(t *testing.T) {
+	t.Run("is called with typed events", func(t *testing.T) {
+		var events []sindr.Event
+		sindrtest.Test(t, `
+def build():
+    shell('echo built', prefix='build')
+
+def failing():
+    fail('broken')
+
+def test_action(ctx):
+    start(build)
+    start(failing)
+    wait()
+    c = cache()
+    c.diff(name='version', version='1')
+
+cli(name="TestEventHandler")
+command(name="test", action=test_action)
+`,
+			// the test logger fails the test when an error is logged
+			sindrtest.WithLogger(logger.JSON{}),
+			sindrtest.WithWriter(io.Discard),
+			sindrtest.WithEventHandler(func(e sindr.Event) { events = append(events, e) }))
+
+		byType := make(map[string][]sindr.Event)
+		for _, e := range events {
+			byType[e.EventType()] = append(byType[e.EventType()], e)
+		}
+
+		require.Len(t, byType["command_start"], 1)
+		assert.Equal(t, "test", byType["command_start"][0].(sindr.CommandStart).Command)
+		require.Len(t, byType["command_end"], 1)
+		assert.Empty(t, byType["command_end"][0].(sindr.CommandEnd).Error)
+
+		require.Len(t, byType["shell_output"], 1)
+		assert.Equal(t, sindr.ShellOutput{Prefix: "build", Stream: "stdout", Line: "built"}, byType["shell_output"][0])
+		require.Len(t, byType["shell_end"], 1)
+		assert.True(t, byType["shell_end"][0].(sindr.ShellEnd).Success)
+
+		require.Len(t, byType["task_spawned"], 2)
+		finished := make(map[string]sindr.TaskFinished)
+		for _, e := range byType["task_finished"] {
+			f := e.(sindr.TaskFinished)
+			finished[f.Name] = f
+		}
+		require.Len(t, finished, 2)
+		assert.True(t, finished["build"].Success)
+		assert.Equal(t, sindr.TaskStart, finished["build"].Kind)
+		assert.False(t, finished["failing"].Success)
+		assert.Contains(t, finished["failing"].Error, "broken")
+
+		require.Len(t, byType["error"], 1)
+		assert.Equal(t, "started function failed", byType["error"][0].(sindr.Error).Message)
+		assert.Contains(t, byType["error"][0].(sindr.Error).Stack, "failing")
+
+		require.Len(t, byType["cache_check"], 1)
+		assert.False(t, byType["cache_check"][0].(sindr.CacheCheck).Hit)
+	})
+
+	t.Run("is called when events aren't logged", func(t *testing.T) {
+		var events []sindr.Event
+		sindrtest.Test(t, `
+def test_action(ctx):
+    shell('echo hidden')
+
+cli(name="TestEventHandler")
+command(name="test", action=test_action)
+`,
+			sindrtest.WithArgs("--quiet", "test"),
+			sindrtest.WithEventHandler(func(e sindr.Event) { events = append(events, e) }))
+
+		assert.Contains(t, events, sindr.ShellOutput{Stream: "stdout", Line: "hidden"})
+	})
+
+	t.Run("is called with the error a command fails with", func(t *testing.T) {
+		var errs []sindr.Error
+		sindrtest.Test(t, `
+def test_action(ctx):
+    fail('broken')
+
+cli(name="TestEventHandler")
+command(name="test", action=test_action)
+`,
+			sindrtest.WithEventHandler(func(e sindr.Event) {
+				if err, ok := e.(sindr.Error); ok {
+					errs = append(errs, err)
+				}
+			}),
+			sindrtest.ShouldFailWith("broken"))
+
+		require.Len(t, errs, 1)
+		assert.Equal(t, "error running sindr", errs[0].Message)
+		assert.Contains(t, errs[0].Error, "broken")
+		assert.Contains(t, errs[0].Stack, "test_action")
+	})
+
+	t.Run("is called with the error the Starlark file fails with", func(t *testing.T) {
+		var errs []sindr.Error
+		sindrtest.Test(t, `
+fail('broken')
+`,
+			sindrtest.WithEventHandler(func(e sindr.Event) {
+				if err, ok := e.(sindr.Error); ok {
+					errs = append(errs, err)
+				}
+			}),
+			sindrtest.ShouldFailWith("broken"))
+
+		require.Len(t, errs, 1)
+		assert.Contains(t, errs[0].Error, "broken")
+	})
+}
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"cmp"
 	"errors"
 	"fmt"
 
@@ -14,12 +15,31 @@ func SindrStringArg(
 	args starlark.Tuple,
 	kwargs []starlark.Tuple,
 ) (starlark.Value, error) {
-	return sindrArg[string](
+	choicesKwargs, kwargs := splitKwargs(kwargs, "choices")
+	var choicesList *starlark.List
+	if err := starlark.UnpackArgs("string_arg", nil, choicesKwargs, "choices?", &choicesList); err != nil {
+		return nil, err
+	}
+	choices, err := parseChoices(choicesList)
+	if err != nil {
+		return nil, err
+	}
+
+	arg, err := sindrArg[string](
 		thread,
 		fn,
 		args,
 		kwargs,
 		func(name, usage string, defaultValue string) (cli.Argument, error) {
+			if choices != nil {
+				if defaultValue != "" {
+					if err := checkChoice(choices, defaultValue); err != nil {
+						return nil, fmt.Errorf("default: %w", err)
+					}
+				}
+				usage = withChoices(cmp.Or(usage, name), choices)
+			}
+
 			return &cli.StringArg{
 				Name:      name,
 				UsageText: usage,
@@ -27,6 +47,15 @@ func SindrStringArg(
 			}, nil
 		},
 	)
+	if err != nil {
+		return nil, err
+	}
+
+	arg.choices = choices
+	if arg.complete == nil && choices != nil {
+		arg.complete = &Completer{values: choices}
+	}
+	return arg, nil
 }
 
 func SindrIntArg(
@@ -51,18 +80,20 @@ func SindrIntArg(
 }
 
 func sindrArg[T any](
-	_ *starlark.Thread,
+	thread *starlark.Thread,
 	_ *starlark.Builtin,
 	args starlark.Tuple,
 	kwargs []starlark.Tuple,
 	newArg func(name, usage string, defaultValue T) (cli.Argument, error),
-) (starlark.Value, error) {
+) (*Arg, error) {
 	var name, usage string
 	var defaultValue T
+	var complete starlark.Value
 	if err := starlark.UnpackArgs("string_flag", args, kwargs,
 		"name", &name,
 		"usage?", &usage,
 		"default?", &defaultValue,
+		"complete?", &complete,
 	); err != nil {
 		return nil, err
 	}
@@ -71,7 +102,15 @@ func sindrArg[T any](
 	if err != nil {
 		return nil, err
 	}
-	return NewArg(name, f), nil
+
+	completer, err := parseCompleter(thread, complete)
+	if err != nil {
+		return nil, fmt.Errorf("complete: %w", err)
+	}
+
+	arg := NewArg(name, f)
+	arg.complete = completer
+	return arg, nil
 }
 
 func processArgs(argsList *starlark.List, cmd *Command) error {
@@ -87,6 +126,15 @@ func processArgs(argsList *starlark.List, cmd *Command) error {
 
 		cmd.Command.Arguments = append(cmd.Command.Arguments, arg.arg)
 		cmd.Args = append(cmd.Args, arg.name)
+		commandCompleters(cmd.Command).args = append(commandCompleters(cmd.Command).args, arg.complete)
+		if arg.choices != nil {
+			choices := argChoices(cmd.Command)
+			if choices == nil {
+				choices = make(map[string][]string)
+				cmd.Command.Metadata[argChoicesKey] = choices
+			}
+			choices[arg.name] = arg.choices
+		}
 	}
 
 	return nil
@@ -95,8 +143,10 @@ func processArgs(argsList *starlark.List, cmd *Command) error {
 var _ starlark.Value = (*Arg)(nil)
 
 type Arg struct {
-	name string
-	arg  cli.Argument
+	name     string
+	arg      cli.Argument
+	complete *Completer
+	choices  []string
 }
 
 func NewArg(name string, flag cli.Argument) *Arg {
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+	"go.starlark.net/starlark"
+)
+
+const argChoicesKey = "sindr_arg_choices"
+
+// parseChoices parses the choices= argument of flags and args, which is nil if it isn't given.
+func parseChoices(list *starlark.List) ([]string, error) {
+	if list == nil {
+		return nil, nil
+	}
+
+	choices, err := fromList(list, castString)
+	if err != nil {
+		return nil, fmt.Errorf("choices: %w", err)
+	}
+	if len(choices) == 0 {
+		return nil, fmt.Errorf("choices: expected at least one choice")
+	}
+	return choices, nil
+}
+
+// argChoices returns the choices of the args of the command, by their name.
+func argChoices(cmd *cli.Command) map[string][]string {
+	choices, _ := cmd.Metadata[argChoicesKey].(map[string][]string)
+	return choices
+}
+
+// checkChoice returns an error if the value isn't one of the choices, suggesting the closest one if any is close.
+func checkChoice(choices []string, value string) error {
+	if slices.Contains(choices, value) {
+		return nil
+	}
+
+	if suggestion := closestChoice(choices, value); suggestion != "" {
+		return fmt.Errorf("must be one of %s, did you mean %q?", strings.Join(choices, ", "), suggestion)
+	}
+	return fmt.Errorf("must be one of %s", strings.Join(choices, ", "))
+}
+
+// withChoices adds the choices to the usage shown in --help.
+func withChoices(usage string, choices []string) string {
+	if len(choices) == 0 {
+		return usage
+	}
+
+	c := "one of " + strings.Join(choices, ", ")
+	if usage == "" {
+		return c
+	}
+	return usage + " (" + c + ")"
+}
+
+// closestChoice returns the choice with the shortest edit distance to value, if it's close enough to be a typo.
+func closestChoice(choices []string, value string) string {
+	var closest string
+	best := -1
+	for _, c := range choices {
+		d := editDistance(strings.ToLower(c), strings.ToLower(value))
+		if d <= max(1, len(c)/2) && (best == -1 || d < best) {
+			closest, best = c, d
+		}
+	}
+	return closest
+}
+
+// editDistance is the number of characters inserted, deleted, substituted or swapped with the next one to go from a to
+// b, the optimal string alignment distance.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
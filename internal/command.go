@@ -4,20 +4,35 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 	"unicode"
 
-	"github.com/charmbracelet/lipgloss"
-	"github.com/charmbracelet/x/ansi"
 	"github.com/urfave/cli/v3"
 	"go.starlark.net/starlark"
 
 	"github.com/mbark/sindr/internal/logger"
+	"github.com/mbark/sindr/internal/trace"
 )
 
 type CLI struct {
 	Command *Command
+	// Shell is the interpreter used to run shell commands, e.g. ["bash", "-c"].
+	Shell []string
+	// Output is the default output mode for pools, see OutputGrouped.
+	Output string
+	// Progress shows the tasks that are running, nil unless enabled with --progress.
+	Progress *Progress
+	// SecretsKeyFile is the file with the key secrets files are encrypted with, see load_secrets().
+	SecretsKeyFile string
+	// Inputs are the files other than Starlark files that commands are defined from, like package.json files.
+	Inputs []string
+
+	mu       sync.Mutex
+	services []*Service
 }
 
 type Command struct {
@@ -33,9 +48,11 @@ func SindrCLI(
 	kwargs []starlark.Tuple,
 ) (starlark.Value, error) {
 	var name, usage string
+	var shell starlark.Value
 	if err := starlark.UnpackArgs("cli", args, kwargs,
 		"name", &name,
 		"usage?", &usage,
+		"shell?", &shell,
 	); err != nil {
 		return nil, err
 	}
@@ -47,6 +64,15 @@ func SindrCLI(
 
 	sindrCLI.Command.Command.Name = name
 	sindrCLI.Command.Command.Usage = usage
+	if shell != nil {
+		sindrCLI.Shell, err = parseInterpreter(shell)
+		if err != nil {
+			return nil, fmt.Errorf("shell: %w", err)
+		}
+		if err := CheckShell(sindrCLI.Shell); err != nil {
+			return nil, fmt.Errorf("shell: %w", err)
+		}
+	}
 	return starlark.None, nil
 }
 
@@ -160,12 +186,6 @@ func SindrSubCommand(
 	return starlark.None, nil
 }
 
-var (
-	actionHeader    = lipgloss.NewStyle().Foreground(lipgloss.ANSIColor(ansi.Magenta)).Bold(true)
-	argOrFlagHeader = lipgloss.NewStyle().Padding(0, 2).Foreground(lipgloss.ANSIColor(ansi.Cyan))
-	argOrFlagStyle  = lipgloss.NewStyle().Faint(true).Padding(0, 4)
-)
-
 // createCommandAction creates the action function for a command.
 func createCommandAction(
 	name string,
@@ -173,16 +193,12 @@ func createCommandAction(
 	action starlark.Callable,
 ) func(context.Context, *cli.Command) error {
 	return func(ctx context.Context, command *cli.Command) error {
-		logger.WithStack(thread.CallStack()).Log(actionHeader.Render(name))
+		started := logger.CommandStart{Command: name, Path: commandPath(command)}
 		if action == nil {
+			logger.LogEvent(logger.WithStack(thread.CallStack()), started)
 			return nil
 		}
 
-		// The help flag is always defined
-		if len(command.Flags) > 1 {
-			logger.WithStack(thread.CallStack()).Log(argOrFlagHeader.Render("Flags"))
-		}
-
 		flags := make(starlark.StringDict)
 		for _, flag := range command.Flags {
 			var sval starlark.Value
@@ -213,53 +229,82 @@ func createCommandAction(
 			for _, f := range flag.Names() {
 				flags[f] = sval
 			}
+			// The help flag is always defined
 			if flag.Names()[0] != "help" {
-				logger.WithStack(thread.CallStack()).Log(
-					argOrFlagStyle.Render(
-						fmt.Sprintf("%s: %s", strings.Join(flag.Names(), ","), lval),
-					),
-				)
+				started.Flags = append(started.Flags, logger.Arg{
+					Name:    flag.Names()[0],
+					Aliases: flag.Names()[1:],
+					Value:   flag.Get(),
+					Display: lval,
+				})
 			}
 		}
 
-		if len(command.Arguments) > 0 {
-			logger.Log(argOrFlagHeader.Render("Named arguments"))
-		}
-
 		argsDict := make(starlark.StringDict)
 		for _, arg := range command.Arguments {
-			var argName, lval string
 			switch a := arg.(type) {
 			case *cli.StringArg:
+				// the default is checked when the arg is defined, and is what args not given have
+				value := command.StringArg(a.Name)
+				if choices, ok := argChoices(command)[a.Name]; ok && value != a.Value {
+					if err := checkChoice(choices, value); err != nil {
+						return fmt.Errorf("invalid value %q for arg %s: %w", value, a.Name, err)
+					}
+				}
 				argsDict[a.Name] = starlark.String(command.StringArg(a.Name))
-				argName, lval = a.Name, fmt.Sprintf("'%s'", command.StringArg(a.Name))
+				started.Args = append(started.Args, logger.Arg{
+					Name:    a.Name,
+					Value:   command.StringArg(a.Name),
+					Display: fmt.Sprintf("'%s'", command.StringArg(a.Name)),
+				})
 			case *cli.IntArg:
 				argsDict[a.Name] = starlark.MakeInt(command.IntArg(a.Name))
-				argName, lval = a.Name, strconv.Itoa(command.IntArg(a.Name))
+				started.Args = append(started.Args, logger.Arg{
+					Name:    a.Name,
+					Value:   command.IntArg(a.Name),
+					Display: strconv.Itoa(command.IntArg(a.Name)),
+				})
 			}
-			logger.WithStack(thread.CallStack()).
-				Log(argOrFlagStyle.Render(fmt.Sprintf("%s: %s", argName, lval)))
 		}
 
 		slice := command.Args().Slice()
 		list := make([]starlark.Value, len(slice))
-		if len(slice) > 0 {
-			logger.WithStack(thread.CallStack()).Log(argOrFlagHeader.Render("Positional arguments"))
-		}
 		for i, a := range slice {
 			list[i] = starlark.String(a)
-			logger.WithStack(thread.CallStack()).
-				Log(argOrFlagStyle.Render(fmt.Sprintf("%d: %s", i, a)))
 		}
+		started.Positional = slice
+		logger.LogEvent(logger.WithStack(thread.CallStack()), started)
 
 		c := NewContext(flags, argsDict, starlark.NewList(list))
 		thread.SetLocal("ctx", c)
 
+		span := trace.Begin(thread, "command", name)
+		start := time.Now()
 		_, err := starlark.Call(thread, action, starlark.Tuple{c}, nil)
+
+		ended := logger.CommandEnd{Command: name, Duration: logger.Duration(time.Since(start))}
+		if err != nil {
+			ended.Error = err.Error()
+		}
+		span.End(map[string]any{"error": ended.Error})
+		logger.LogEvent(logger.WithStack(thread.CallStack()), ended)
 		return err
 	}
 }
 
+// commandPath returns the names of the command and its parents, without the root command of the CLI.
+func commandPath(command *cli.Command) []string {
+	var path []string
+	for _, c := range command.Lineage() {
+		if c.Root() == c {
+			break
+		}
+		path = append(path, c.Name)
+	}
+	slices.Reverse(path)
+	return path
+}
+
 func findSubCommand(cmd *cli.Command, path []string) (*cli.Command, error) {
 	if len(path) == 0 {
 		return nil, fmt.Errorf("empty path")
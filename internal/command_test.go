@@ -1,8 +1,10 @@
 package internal_test
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"go.starlark.net/starlark"
 
 	"github.com/mbark/sindr/internal"
@@ -461,6 +463,65 @@ command(
 	})
 }
 
+func TestChoices(t *testing.T) {
+	script := `
+def deploy_action(ctx):
+    print("deploying", ctx.args.target, "to", ctx.flags.env)
+
+cli(name="TestChoices")
+command(
+    name="deploy",
+    action=deploy_action,
+    args=[string_arg("target", choices=["web", "worker"])],
+    flags=[string_flag("env", usage="Where to deploy", default="staging", choices=["staging", "production"])],
+)
+`
+
+	t.Run("accepts the choices", func(t *testing.T) {
+		sindrtest.Test(t, script, sindrtest.WithArgs("deploy", "--env", "production", "worker"))
+		sindrtest.Test(t, script, sindrtest.WithArgs("deploy"))
+	})
+
+	t.Run("rejects flags with other values", func(t *testing.T) {
+		sindrtest.Test(t, script, sindrtest.WithArgs("deploy", "--env", "prodution", "web"),
+			sindrtest.ShouldFailWith(`invalid value "prodution" for flag -env: `+
+				`must be one of staging, production, did you mean "production"?`))
+	})
+
+	t.Run("rejects args with other values", func(t *testing.T) {
+		sindrtest.Test(t, script, sindrtest.WithArgs("deploy", "wbe"),
+			sindrtest.ShouldFailWith(`invalid value "wbe" for arg target: `+
+				`must be one of web, worker, did you mean "web"?`))
+		sindrtest.Test(t, script, sindrtest.WithArgs("deploy", "database"),
+			sindrtest.ShouldFailWith(`invalid value "database" for arg target: must be one of web, worker`))
+	})
+
+	t.Run("rejects defaults that aren't a choice", func(t *testing.T) {
+		sindrtest.Test(t, `string_flag("env", default="dev", choices=["staging", "production"])`,
+			sindrtest.ShouldFailWith("default: must be one of staging, production"))
+	})
+
+	t.Run("shows the choices in the help", func(t *testing.T) {
+		writer := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, script, sindrtest.WithArgs("deploy", "--help"), sindrtest.WithWriter(writer))
+		help := strings.Join(writer.Writes, "")
+		assert.Contains(t, help, "target (one of web, worker)")
+		assert.Contains(t, help, "Where to deploy (one of staging, production)")
+	})
+
+	t.Run("completes the choices", func(t *testing.T) {
+		writer := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, script, sindrtest.WithArgs("__complete", "--", "sindr", "deploy", "--env", "p"),
+			sindrtest.WithWriter(writer))
+		assert.Equal(t, []string{"production\n"}, writer.Writes)
+
+		writer = new(sindrtest.CollectWriter)
+		sindrtest.Test(t, script, sindrtest.WithArgs("__complete", "--", "sindr", "deploy", "w"),
+			sindrtest.WithWriter(writer))
+		assert.Equal(t, []string{"web\n", "worker\n"}, writer.Writes)
+	})
+}
+
 func TestInvalidConfigurations(t *testing.T) {
 	t.Run("invalid flag type should fail", func(t *testing.T) {
 		sindrtest.Test(t, `
@@ -0,0 +1,296 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	"go.starlark.net/starlark"
+)
+
+// CompletionSessionEnv is set by the completion scripts to the PID of the shell, so that the values of functions given
+// as complete= are cached for as long as the shell runs.
+const CompletionSessionEnv = "SINDR_COMPLETION_SESSION"
+
+const (
+	completeFile = "file"
+	completeDir  = "dir"
+
+	completersKey = "sindr_completers"
+	// completionSessionTTL is how long the cached values of a shell session are kept after they were last written.
+	completionSessionTTL = 24 * time.Hour
+)
+
+// Completer completes the values of a flag or argument, from a list of values, the files or directories matching some
+// globs, or the values returned by a Starlark function.
+type Completer struct {
+	values   []string
+	kind     string
+	globs    []string
+	function bool
+	fn       starlark.Callable
+	thread   *starlark.Thread
+}
+
+// completerJSON is how a Completer is kept in a snapshot, where functions can't be called without running the Starlark
+// file again.
+type completerJSON struct {
+	Values   []string `json:"values,omitempty"`
+	Kind     string   `json:"kind,omitempty"`
+	Globs    []string `json:"globs,omitempty"`
+	Function bool     `json:"function,omitempty"`
+}
+
+func (c *Completer) MarshalJSON() ([]byte, error) {
+	return json.Marshal(completerJSON{Values: c.values, Kind: c.kind, Globs: c.globs, Function: c.function})
+}
+
+func (c *Completer) UnmarshalJSON(b []byte) error {
+	var v completerJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*c = Completer{values: v.Values, kind: v.Kind, globs: v.Globs, function: v.Function}
+	return nil
+}
+
+// parseCompleter parses the complete= argument of flags and args, which is nil if it isn't given.
+func parseCompleter(thread *starlark.Thread, v starlark.Value) (*Completer, error) {
+	switch v := v.(type) {
+	case nil, starlark.NoneType:
+		return nil, nil
+	case *starlark.List:
+		values, err := fromList(v, castString)
+		if err != nil {
+			return nil, err
+		}
+		return &Completer{values: values}, nil
+	case starlark.String:
+		kind, globs, _ := strings.Cut(string(v), ":")
+		if kind != completeFile && kind != completeDir {
+			return nil, fmt.Errorf("expected %q or %q with optional globs, got %q", completeFile, completeDir, v)
+		}
+
+		c := &Completer{kind: kind}
+		if globs != "" {
+			c.globs = strings.Split(globs, ",")
+		}
+		for _, g := range c.globs {
+			if _, err := filepath.Match(g, ""); err != nil {
+				return nil, fmt.Errorf("glob %q: %w", g, err)
+			}
+		}
+		return c, nil
+	case starlark.Callable:
+		return &Completer{function: true, fn: v, thread: thread}, nil
+	default:
+		return nil, fmt.Errorf("expected list, string or function, got %s", v.Type())
+	}
+}
+
+// completers are the completers of the flags and args of a command, kept in its metadata.
+type completers struct {
+	// flags are keyed by every spelling of the flag names, e.g. --env and -e.
+	flags map[string]*Completer
+	// args are in the order of the args, nil for the ones without a completer.
+	args []*Completer
+}
+
+func commandCompleters(cmd *cli.Command) *completers {
+	if c, ok := cmd.Metadata[completersKey].(*completers); ok {
+		return c
+	}
+
+	c := &completers{flags: make(map[string]*Completer)}
+	if cmd.Metadata == nil {
+		cmd.Metadata = make(map[string]any)
+	}
+	cmd.Metadata[completersKey] = c
+	return c
+}
+
+// CompletionSession is the state kept while completing, with the directory completion is run from and the cached
+// values of complete= functions.
+type CompletionSession struct {
+	cwd string
+	// starlarkFile is the Starlark file completed for, as the cached values are kept per file.
+	starlarkFile string
+	file         string
+	values       map[string][]string
+	changed      bool
+
+	// uncached is set when a function needs to be called to complete, which a snapshot can't do.
+	uncached bool
+	snapshot snapshotConfig
+}
+
+// NewCompletionSession creates the session for completing the commands of the Starlark file in cwd. The values of
+// complete= functions are cached in cacheDir for the shell session given by CompletionSessionEnv, if any.
+func NewCompletionSession(cwd, cacheDir, starlarkFile string) *CompletionSession {
+	s := &CompletionSession{cwd: cwd, starlarkFile: starlarkFile, values: make(map[string][]string)}
+
+	id := os.Getenv(CompletionSessionEnv)
+	if id == "" || filepath.Base(id) != id {
+		return s
+	}
+
+	s.file = filepath.Join(cacheDir, "completions", id+".json")
+	if b, err := os.ReadFile(s.file); err == nil {
+		_ = json.Unmarshal(b, &s.values)
+	}
+	return s
+}
+
+// complete returns the values of the completer starting with curtok. Name is the flag or arg being completed for the
+// command at path.
+func (s *CompletionSession) complete(path []string, c *Completer, name, curtok string) []Completion {
+	if c == nil {
+		return nil
+	}
+	if c.kind != "" {
+		return completeFiles(s.cwd, curtok, c.kind == completeDir, c.globs)
+	}
+
+	values := c.values
+	if c.function {
+		values = s.call(path, c, name)
+	}
+
+	var out []Completion
+	for _, v := range values {
+		if strings.HasPrefix(v, curtok) {
+			out = append(out, Completion{Text: v})
+		}
+	}
+	return out
+}
+
+// call returns the values of the complete= function, calling it only if the values aren't cached. Functions failing
+// complete nothing, as there's nowhere to show the error.
+func (s *CompletionSession) call(path []string, c *Completer, name string) []string {
+	// the same command can be defined differently by the Starlark files of other projects
+	key := s.starlarkFile + ":" + strings.Join(append(slices.Clone(path), name), " ")
+	if values, ok := s.values[key]; ok {
+		return values
+	}
+	if c.fn == nil {
+		s.uncached = true
+		return nil
+	}
+
+	res, err := starlark.Call(c.thread, c.fn, nil, nil)
+	if err != nil {
+		return nil
+	}
+	iterable, ok := res.(starlark.Iterable)
+	if !ok {
+		return nil
+	}
+
+	var values []string
+	for v := range starlark.Elements(iterable) {
+		str, err := castString(v)
+		if err != nil {
+			return nil
+		}
+		values = append(values, str)
+	}
+
+	s.values[key] = values
+	s.changed = true
+	return values
+}
+
+// save writes the cached values of the session, removing the ones of shell sessions that haven't been used for a
+// while.
+func (s *CompletionSession) save() error {
+	if s.file == "" || !s.changed {
+		return nil
+	}
+
+	dir := filepath.Dir(s.file)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("completion cache: %w", err)
+	}
+	b, err := json.Marshal(s.values)
+	if err != nil {
+		return fmt.Errorf("marshal completion cache: %w", err)
+	}
+	if err := os.WriteFile(s.file, b, 0o600); err != nil {
+		return fmt.Errorf("write completion cache: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err == nil && time.Since(info.ModTime()) > completionSessionTTL {
+			_ = os.Remove(filepath.Join(dir, e.Name()))
+		}
+	}
+	return nil
+}
+
+// completeFiles completes the files and directories starting with curtok, relative to cwd. Directories are always
+// completed for files, so that they can be completed within.
+func completeFiles(cwd, curtok string, dirsOnly bool, globs []string) []Completion {
+	dir, base := filepath.Split(curtok)
+	readDir := dir
+	if !filepath.IsAbs(readDir) {
+		readDir = filepath.Join(cwd, readDir)
+	}
+
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return nil
+	}
+
+	var out []Completion
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+
+		// stat to follow symlinks to directories
+		info, err := os.Stat(filepath.Join(readDir, name))
+		if err != nil {
+			continue
+		}
+
+		path := dir + name
+		switch {
+		case info.IsDir() && (!dirsOnly || matchesGlobs(globs, path)):
+			out = append(out, Completion{Text: path + string(filepath.Separator)})
+		case !info.IsDir() && !dirsOnly && matchesGlobs(globs, path):
+			out = append(out, Completion{Text: path})
+		}
+	}
+	return out
+}
+
+// matchesGlobs returns whether the path matches any of the globs, or if there are none. Globs without a separator are
+// matched against the name of the file.
+func matchesGlobs(globs []string, path string) bool {
+	if len(globs) == 0 {
+		return true
+	}
+
+	for _, g := range globs {
+		name := filepath.Base(path)
+		if strings.ContainsRune(g, filepath.Separator) {
+			name = filepath.Clean(path)
+		}
+		if ok, err := filepath.Match(g, name); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
@@ -3,7 +3,9 @@ package internal
 import (
 	"context"
 	_ "embed"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/urfave/cli/v3"
@@ -11,16 +13,36 @@ import (
 	"github.com/mbark/sindr/internal/logger"
 )
 
-//go:embed completion/completion.fish
-var fishCompletion string
+var (
+	//go:embed completion/completion.bash
+	bashCompletion string
+	//go:embed completion/completion.zsh
+	zshCompletion string
+	//go:embed completion/completion.fish
+	fishCompletion string
+	//go:embed completion/completion.ps1
+	powershellCompletion string
+)
+
+// shellCompletions are the completion scripts for each shell, which all call __complete to complete from the Starlark
+// file in the current directory.
+var shellCompletions = map[string]string{
+	"bash":       bashCompletion,
+	"zsh":        zshCompletion,
+	"fish":       fishCompletion,
+	"powershell": powershellCompletion,
+	"pwsh":       powershellCompletion,
+}
 
 func ConfigureShellCompletionCommand(cmd *cli.Command) {
 	action := cmd.Action
 	cmd.Action = func(ctx context.Context, command *cli.Command) error {
 		args := command.Args().Slice()
-		if len(args) > 0 && args[0] == "fish" {
-			logger.Print(fishCompletion)
-			return nil
+		if len(args) > 0 {
+			if script, ok := shellCompletions[args[0]]; ok {
+				logger.Print(script)
+				return nil
+			}
 		}
 
 		return action(ctx, command)
@@ -51,20 +73,70 @@ func normalizeFlagSpelling(n string) string {
 	return "--" + n
 }
 
+// CompletionCommand is the command tree completion is computed from, with only the visible commands and flags. It's
+// kept in a snapshot so that completing doesn't need to run the Starlark file.
+type CompletionCommand struct {
+	Name     string               `json:"name"`
+	Aliases  []string             `json:"aliases,omitempty"`
+	Usage    string               `json:"usage,omitempty"`
+	Flags    []*CompletionFlag    `json:"flags,omitempty"`
+	Args     []*Completer         `json:"args,omitempty"`
+	Commands []*CompletionCommand `json:"commands,omitempty"`
+}
+
+type CompletionFlag struct {
+	Names []string `json:"names"`
+	// Desc describes the flag, which is its help text.
+	Desc       string     `json:"desc,omitempty"`
+	TakesValue bool       `json:"takes_value,omitempty"`
+	Complete   *Completer `json:"complete,omitempty"`
+}
+
+// NewCompletionCommand creates the command tree to complete from cmd.
+func NewCompletionCommand(cmd *cli.Command) *CompletionCommand {
+	completers := commandCompleters(cmd)
+	c := &CompletionCommand{
+		Name:    cmd.Name,
+		Aliases: cmd.Aliases,
+		Usage:   cmd.Usage,
+		Args:    completers.args,
+	}
+
+	for _, f := range cmd.VisibleFlags() {
+		flag := &CompletionFlag{Names: f.Names(), Desc: f.String(), TakesValue: flagTakesValue(f)}
+		for _, n := range f.Names() {
+			if complete, ok := completers.flags[normalizeFlagSpelling(n)]; ok {
+				flag.Complete = complete
+			}
+		}
+		c.Flags = append(c.Flags, flag)
+	}
+	for _, sub := range cmd.VisibleCommands() {
+		c.Commands = append(c.Commands, NewCompletionCommand(sub))
+	}
+	return c
+}
+
+func (c *CompletionCommand) HasName(name string) bool {
+	return c.Name == name || slices.Contains(c.Aliases, name)
+}
+
 type ctxState struct {
-	curCmd          *cli.Command
+	curCmd          *CompletionCommand
+	path            []string // names of the commands walked to, without the root
 	waitingForValue bool
 	waitingFlagName string
+	positional      int  // positional arguments given to curCmd
 	helpMode        bool // user typed "help" (or "h") somewhere
 }
 
-func walkToCommand(root *cli.Command, tokens []string) (st ctxState) {
+func walkToCommand(root *CompletionCommand, tokens []string) (st ctxState) {
 	cur := root
 
-	flagLookup := func(cmd *cli.Command) map[string]cli.Flag {
-		m := map[string]cli.Flag{}
-		for _, f := range cmd.VisibleFlags() {
-			for _, nm := range f.Names() {
+	flagLookup := func(cmd *CompletionCommand) map[string]*CompletionFlag {
+		m := map[string]*CompletionFlag{}
+		for _, f := range cmd.Flags {
+			for _, nm := range f.Names {
 				m[normalizeFlagSpelling(nm)] = f
 			}
 		}
@@ -84,7 +156,7 @@ func walkToCommand(root *cli.Command, tokens []string) (st ctxState) {
 		// --flag=value
 		if strings.HasPrefix(tok, "--") && strings.Contains(tok, "=") {
 			name := tok[:strings.IndexByte(tok, '=')]
-			if f, ok := flagLookup(cur)[name]; ok && flagTakesValue(f) {
+			if f, ok := flagLookup(cur)[name]; ok && f.TakesValue {
 				i++
 				continue
 			}
@@ -93,7 +165,7 @@ func walkToCommand(root *cli.Command, tokens []string) (st ctxState) {
 		// Flags
 		if strings.HasPrefix(tok, "-") {
 			if f, ok := flagLookup(cur)[tok]; ok {
-				if flagTakesValue(f) {
+				if f.TakesValue {
 					st.waitingForValue = true
 					st.waitingFlagName = tok
 				}
@@ -112,8 +184,8 @@ func walkToCommand(root *cli.Command, tokens []string) (st ctxState) {
 		}
 
 		// Subcommand descent
-		var next *cli.Command
-		for _, c := range cur.VisibleCommands() {
+		var next *CompletionCommand
+		for _, c := range cur.Commands {
 			if c.HasName(tok) {
 				next = c
 				break
@@ -121,11 +193,14 @@ func walkToCommand(root *cli.Command, tokens []string) (st ctxState) {
 		}
 		if next != nil {
 			cur = next
+			st.path = append(st.path, next.Name)
+			st.positional = 0
 			i++
 			continue
 		}
 
 		// Positional arg
+		st.positional++
 		i++
 	}
 
@@ -134,8 +209,8 @@ func walkToCommand(root *cli.Command, tokens []string) (st ctxState) {
 }
 
 // helper: does this command already have a "help" child?
-func hasHelpChild(cmd *cli.Command) bool {
-	for _, c := range cmd.VisibleCommands() {
+func hasHelpChild(cmd *CompletionCommand) bool {
+	for _, c := range cmd.Commands {
 		if c.HasName("help") || c.HasName("h") {
 			return true
 		}
@@ -143,15 +218,25 @@ func hasHelpChild(cmd *cli.Command) bool {
 	return false
 }
 
-func ComputeCompletions(app *cli.Command, tokens []string, curtok string) []Completion {
+func ComputeCompletions(
+	app *CompletionCommand,
+	tokens []string,
+	curtok string,
+	session *CompletionSession,
+) []Completion {
 	st := walkToCommand(app, tokens)
 
-	// Case 1: currently providing a flag value → no command/flag suggestions
+	// Case 1: currently providing a flag value → only the values of the flag
 	if st.waitingForValue {
-		return nil
+		return session.complete(st.path, st.curCmd.flag(st.waitingFlagName), st.waitingFlagName, curtok)
 	}
-	if strings.HasPrefix(curtok, "--") && strings.HasSuffix(curtok, "=") {
-		return nil
+	if strings.HasPrefix(curtok, "--") && strings.Contains(curtok, "=") {
+		name, value, _ := strings.Cut(curtok, "=")
+		comps := session.complete(st.path, st.curCmd.flag(name), name, value)
+		for i := range comps {
+			comps[i].Text = name + "=" + comps[i].Text
+		}
+		return comps
 	}
 
 	// Decide kind of suggestions
@@ -163,7 +248,7 @@ func ComputeCompletions(app *cli.Command, tokens []string, curtok string) []Comp
 
 	if onlySubcommands {
 		// Current command's subcommands
-		for _, c := range st.curCmd.VisibleCommands() {
+		for _, c := range st.curCmd.Commands {
 			name := c.Name
 			if curtok == "" || strings.HasPrefix(name, curtok) {
 				out = append(out, Completion{Text: name, Desc: c.Usage})
@@ -190,43 +275,80 @@ func ComputeCompletions(app *cli.Command, tokens []string, curtok string) []Comp
 				})
 			}
 		}
+		if !st.helpMode && st.positional < len(st.curCmd.Args) {
+			name := fmt.Sprintf("arg %d", st.positional)
+			out = append(out, session.complete(st.path, st.curCmd.Args[st.positional], name, curtok)...)
+		}
 		return out
 	}
 
 	// Otherwise: flags for the current command level
-	for _, f := range st.curCmd.VisibleFlags() {
-		usage := f.String() // good enough for a description
-		for _, n := range f.Names() {
+	for _, f := range st.curCmd.Flags {
+		for _, n := range f.Names {
 			sp := normalizeFlagSpelling(n)
 			if curtok == "" || strings.HasPrefix(sp, curtok) {
-				out = append(out, Completion{Text: sp, Desc: usage})
+				out = append(out, Completion{Text: sp, Desc: f.Desc})
 			}
 		}
 	}
 	return out
 }
 
+// flag returns the completer of the flag with the name, as it's spelled on the command line.
+func (c *CompletionCommand) flag(name string) *Completer {
+	for _, f := range c.Flags {
+		for _, n := range f.Names {
+			if normalizeFlagSpelling(n) == name {
+				return f.Complete
+			}
+		}
+	}
+	return nil
+}
+
 // ---- wire it to the hidden command ----------------------------------------
 
-func CompleteAction(app *cli.Command) cli.ActionFunc {
+func CompleteAction(app *cli.Command, session *CompletionSession) cli.ActionFunc {
 	return func(ctx context.Context, c *cli.Command) error {
-		// Expect: tokens = -opc (previous tokens), curtok = -ct (current token being edited)
-		args := c.Args().Slice()
-		// The last arg we pass in our fish function is the current token (can be empty).
-		var tokens []string
-		var curtok string
-		if len(args) > 0 {
-			tokens = args[:len(args)-1]
-			curtok = args[len(args)-1]
-		}
-		comps := ComputeCompletions(app, tokens, curtok)
-		for _, x := range comps {
-			if x.Desc != "" {
-				logger.Print(fmt.Sprintf("%s\t%s\n", x.Text, x.Desc))
-			} else {
-				logger.Print(x.Text + "\n")
-			}
+		cmd := NewCompletionCommand(app)
+		printCompletions(complete(cmd, c.Args().Slice(), session))
+		return errors.Join(session.save(), session.saveSnapshot(cmd))
+	}
+}
+
+// complete returns the completions for args, as given to __complete.
+func complete(app *CompletionCommand, args []string, session *CompletionSession) []Completion {
+	// Expect: tokens = -opc (previous tokens), curtok = -ct (current token being edited)
+	// The last arg the completion scripts pass is the current token (can be empty).
+	var tokens []string
+	var curtok string
+	if len(args) > 0 {
+		tokens = args[:len(args)-1]
+		curtok = args[len(args)-1]
+	}
+	// The completion scripts pass the whole command line, starting with the name of the program.
+	if len(tokens) > 0 && (tokens[0] == "sindr" || tokens[0] == app.Name) && !isSubcommand(app, tokens[0]) {
+		tokens = tokens[1:]
+	}
+
+	return ComputeCompletions(app, tokens, curtok, session)
+}
+
+func printCompletions(comps []Completion) {
+	for _, x := range comps {
+		if x.Desc != "" {
+			logger.Print(fmt.Sprintf("%s\t%s\n", x.Text, x.Desc))
+		} else {
+			logger.Print(x.Text + "\n")
 		}
-		return nil
 	}
 }
+
+func isSubcommand(cmd *CompletionCommand, name string) bool {
+	for _, c := range cmd.Commands {
+		if c.HasName(name) {
+			return true
+		}
+	}
+	return false
+}
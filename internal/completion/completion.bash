@@ -0,0 +1,55 @@
+# _sindr_words sets words and cword from COMP_WORDS, joining the words bash splits on = and :, like --flag=value, like
+# _get_comp_words_by_ref -n "=:" of bash-completion does.
+_sindr_words() {
+    words=()
+    cword=0
+    local i word n
+    for ((i = 0; i < ${#COMP_WORDS[@]}; i++)); do
+        word=${COMP_WORDS[i]}
+        # without negative indices, which need bash 4.3
+        n=${#words[@]}
+        if [[ $n -gt 0 && -n $word && ($word == [=:] || ${words[n - 1]} == *[=:]) ]]; then
+            words[n - 1]=${words[n - 1]}$word
+        else
+            words+=("$word")
+        fi
+        if [[ $i -eq $COMP_CWORD ]]; then
+            cword=$((${#words[@]} - 1))
+        fi
+    done
+}
+
+_sindr_complete() {
+    # the words are split like the shell does, keeping quoted arguments with spaces together
+    local cur words cword
+    if declare -F _get_comp_words_by_ref >/dev/null 2>&1; then
+        _get_comp_words_by_ref -n "=:" cur words cword
+    else
+        _sindr_words
+        cur=${words[cword]}
+    fi
+    local curtok=$cur
+    local -a tokens=("${words[@]:0:cword}")
+
+    # bash splits words on the characters in COMP_WORDBREAKS, like = in --flag=value, so only the part after the last
+    # of them is replaced.
+    local prefix=""
+    if [[ $curtok == *[=:]* ]]; then
+        prefix=${curtok%"${curtok##*[=:]}"}
+    fi
+
+    COMPREPLY=()
+    local completion
+    while IFS= read -r completion; do
+        [[ -n $completion ]] || continue
+        completion=${completion%%$'\t'*}
+        COMPREPLY+=("${completion#"$prefix"}")
+    done < <(SINDR_COMPLETION_SESSION=$$ sindr __complete -- "${tokens[@]}" "$curtok" 2>/dev/null)
+
+    # don't add a space after directories, so that files in them can be completed
+    if [[ ${#COMPREPLY[@]} -eq 1 && ${COMPREPLY[0]} == */ ]]; then
+        compopt -o nospace 2>/dev/null
+    fi
+}
+
+complete -F _sindr_complete sindr
@@ -1,6 +1,7 @@
 function __fish_sindr_complete
     set -l tokens (commandline -opc)
     set -l curtok (commandline -ct)
+    set -lx SINDR_COMPLETION_SESSION $fish_pid
     sindr __complete -- $tokens $curtok
 end
 
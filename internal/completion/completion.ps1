@@ -0,0 +1,29 @@
+Register-ArgumentCompleter -Native -CommandName sindr -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+
+    $tokens = @($commandAst.CommandElements |
+        Where-Object { $_.Extent.StartOffset -lt ($cursorPosition - $wordToComplete.Length) } |
+        ForEach-Object { $_.Extent.Text })
+
+    # Empty arguments are dropped when passed to native commands with the legacy argument passing.
+    $curtok = $wordToComplete
+    if ($curtok -eq '' -and ($PSVersionTable.PSVersion -lt [version]'7.3' -or $PSNativeCommandArgumentPassing -eq 'Legacy')) {
+        $curtok = '""'
+    }
+
+    # only set for sindr __complete, as the environment of the session is inherited by everything run from it
+    $session = $env:SINDR_COMPLETION_SESSION
+    $env:SINDR_COMPLETION_SESSION = $PID
+    try {
+        $completions = @(sindr __complete -- @tokens $curtok 2>$null)
+    } finally {
+        $env:SINDR_COMPLETION_SESSION = $session
+    }
+
+    $completions | ForEach-Object {
+        $text, $desc = $_ -split "`t", 2
+        if (-not $text) { return }
+        if (-not $desc) { $desc = $text }
+        [System.Management.Automation.CompletionResult]::new($text, $text, 'ParameterValue', $desc)
+    }
+}
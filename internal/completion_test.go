@@ -2,6 +2,9 @@ package internal_test
 
 import (
 	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -28,13 +31,22 @@ command(name="deploy", action=deploy_action)
 			sindrtest.WithArgs("__complete"),
 			sindrtest.WithWriter(writer))
 
-		require.Len(t, writer.Writes, 4)
+		require.Len(t, writer.Writes, 9)
 		assert.Equal(t, "build\n", writer.Writes[0])
 		assert.Equal(t, "deploy\n", writer.Writes[1])
+		assert.Equal(t, "history\tShows the commands run, with the latest first\n", writer.Writes[2])
+		assert.Equal(t,
+			"rerun\tRuns a command from the history again, with the same flags and arguments\n",
+			writer.Writes[3])
+		assert.Equal(t,
+			"secrets\tEncrypts, decrypts and edits secrets files read with load_secrets()\n",
+			writer.Writes[4])
+		assert.Equal(t, "allow\tTrusts the Starlark file to be run, until it's changed\n", writer.Writes[5])
+		assert.Equal(t, "deny\tStops trusting the Starlark file to be run\n", writer.Writes[6])
 
 		helpUsage := "Shows a list of commands or help for one command"
-		assert.Equal(t, fmt.Sprintf("help\t%s\n", helpUsage), writer.Writes[2])
-		assert.Equal(t, fmt.Sprintf("h\t%s (alias)\n", helpUsage), writer.Writes[3])
+		assert.Equal(t, fmt.Sprintf("help\t%s\n", helpUsage), writer.Writes[7])
+		assert.Equal(t, fmt.Sprintf("h\t%s (alias)\n", helpUsage), writer.Writes[8])
 	})
 
 	t.Run("completion shows flags at root level", func(t *testing.T) {
@@ -58,14 +70,22 @@ command(name="deploy", action=deploy_action)
 		assert.Equal(t, strings.TrimSpace(
 			`
 --cache-dir	--cache-dir string	path to the Starlark config file
+--ci	--ci string	format logs for a CI system: github, gitlab or none, detected if not set
 --file-name	--file-name string, -f string	path to the Starlark config file
 -f	--file-name string, -f string	path to the Starlark config file
 --line-numbers	--line-numbers, -l	print logs with Starlark line numbers if possible (default: false)
 -l	--line-numbers, -l	print logs with Starlark line numbers if possible (default: false)
+--log-format	--log-format string	how to format logs: text or json
 --no-cache	--no-cache, -n	ignore stored values in the cache (default: false)
 -n	--no-cache, -n	ignore stored values in the cache (default: false)
---verbose	--verbose, -v	print logs to stdout (default: false)
--v	--verbose, -v	print logs to stdout (default: false)
+--output	--output string	how to show output of parallel tasks: interleaved, grouped or failed-only
+--progress	--progress	show the progress of running tasks (default: false)
+--quiet	--quiet, -q	only print errors and data from emit() (default: false)
+-q	--quiet, -q	only print errors and data from emit() (default: false)
+--report	--report string	write a report of the steps run to a JUnit .xml or a .json file
+--trace	--trace string	write a trace of the run to a file, in the Chrome trace event format
+--verbose	--verbose, -v	print verbose logs (default: false)
+-v	--verbose, -v	print verbose logs (default: false)
 --help	--help, -h	show help
 -h	--help, -h	show help
 `)+"\n", joined)
@@ -160,4 +180,300 @@ command(name="deploy", action=deploy_action)
 		}
 		assert.True(t, contains, "Expected to find fish completion function in output")
 	})
+
+	t.Run("has completion for every shell", func(t *testing.T) {
+		for shell, want := range map[string]string{
+			"bash":       "complete -F _sindr_complete sindr",
+			"zsh":        "compdef _sindr sindr",
+			"powershell": "Register-ArgumentCompleter -Native -CommandName sindr",
+			"pwsh":       "Register-ArgumentCompleter -Native -CommandName sindr",
+		} {
+			writer := new(sindrtest.CollectWriter)
+			sindrtest.Test(t, `cli(name="TestApp")`,
+				sindrtest.WithArgs("completion", shell),
+				sindrtest.WithWriter(writer))
+			assert.Contains(t, strings.Join(writer.Writes, ""), want, shell)
+			assert.Contains(t, strings.Join(writer.Writes, ""), "sindr __complete --", shell)
+		}
+	})
+}
+
+func TestBashCompletion(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is not installed")
+	}
+
+	script := `
+def deploy_action(ctx):
+    print("deploying")
+
+cli(name="TestApp", usage="test app")
+command(name="deploy", usage="Deploy the app", action=deploy_action)
+sub_command(path=["deploy", "staging"], usage="Deploy to staging", action=deploy_action)
+sub_command(path=["deploy", "production"], usage="Deploy to production", action=deploy_action)
+`
+
+	writer := new(sindrtest.CollectWriter)
+	sindrtest.Test(t, script, sindrtest.WithArgs("completion", "bash"), sindrtest.WithWriter(writer))
+	completion := filepath.Join(t.TempDir(), "sindr.bash")
+	require.NoError(t, os.WriteFile(completion, []byte(strings.Join(writer.Writes, "")), 0o600))
+
+	// complete runs the completion for the words in bash, split like bash does with the last one being completed, with
+	// a sindr that returns output and records the arguments it's called with.
+	complete := func(t *testing.T, output string, words ...string) (args, completions []string) {
+		t.Helper()
+		args, out := runCompletion(t, output, bash, append([]string{"--norc", "-c", `source "$1"; shift
+COMP_WORDS=("$@") COMP_CWORD=$(($# - 1)) COMP_LINE="$*" COMP_POINT=${#COMP_LINE}
+_sindr_complete
+printf '%s\n' "${COMPREPLY[@]}"`, "bash", completion}, words...)...)
+		return args, strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	}
+
+	t.Run("completes subcommands without descriptions", func(t *testing.T) {
+		args, completions := complete(t, `staging\tDeploy to staging\nproduction\tDeploy to production\n`,
+			"sindr", "deploy", "")
+		assert.Equal(t, []string{"__complete", "--", "sindr", "deploy", ""}, args)
+		assert.Equal(t, []string{"staging", "production"}, completions)
+
+		writer := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, script, sindrtest.WithArgs(args...), sindrtest.WithWriter(writer))
+		require.GreaterOrEqual(t, len(writer.Writes), 2)
+		assert.Equal(t, []string{"staging\tDeploy to staging\n", "production\tDeploy to production\n"},
+			writer.Writes[:2])
+	})
+
+	t.Run("passes the word being completed", func(t *testing.T) {
+		args, completions := complete(t, `staging\tDeploy to staging\n`, "sindr", "deploy", "st")
+		assert.Equal(t, []string{"__complete", "--", "sindr", "deploy", "st"}, args)
+		assert.Equal(t, []string{"staging"}, completions)
+	})
+
+	t.Run("only replaces the value of flags", func(t *testing.T) {
+		args, completions := complete(t, `--file-name=sindr.star\n`, "sindr", "--file-name", "=", "sin")
+		assert.Equal(t, []string{"__complete", "--", "sindr", "--file-name=sin"}, args)
+		assert.Equal(t, []string{"sindr.star"}, completions)
+	})
+
+	t.Run("keeps quoted arguments with spaces together", func(t *testing.T) {
+		args, _ := complete(t, `staging\tDeploy to staging\n`, "sindr", "deploy", `"a b"`, "st")
+		assert.Equal(t, []string{"__complete", "--", "sindr", "deploy", `"a b"`, "st"}, args)
+	})
+}
+
+func TestValueCompletion(t *testing.T) {
+	script := `
+def list_regions():
+    return ["eu-north-1", "us-east-1"]
+
+def action(ctx):
+    pass
+
+cli(name="TestApp")
+command(name="deploy", action=action, flags=[
+    string_flag(name="env", complete=["staging", "production"]),
+    string_flag(name="region", complete=list_regions),
+])
+command(name="migrate", action=action, args=[
+    string_arg(name="name"),
+    string_arg(name="file", complete="file:*.sql"),
+])
+`
+
+	complete := func(t *testing.T, opts []sindrtest.TestOption, args ...string) []string {
+		t.Helper()
+		writer := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, script, append(opts,
+			sindrtest.WithArgs(append([]string{"__complete", "--", "sindr"}, args...)...),
+			sindrtest.WithWriter(writer))...)
+		return writer.Writes
+	}
+
+	t.Run("completes flag values from a list", func(t *testing.T) {
+		assert.Equal(t, []string{"staging\n", "production\n"}, complete(t, nil, "deploy", "--env", ""))
+		assert.Equal(t, []string{"production\n"}, complete(t, nil, "deploy", "--env", "pr"))
+		assert.Equal(t, []string{"--env=staging\n"}, complete(t, nil, "deploy", "--env=st"))
+	})
+
+	t.Run("completes args with files matching the globs", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "migrations", "old"), 0o700))
+		for _, f := range []string{"001_init.sql", "002_users.sql", "README.md"} {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "migrations", f), nil, 0o600))
+		}
+
+		prefix := filepath.Join(dir, "migrations") + "/"
+		assert.Equal(t, []string{prefix + "001_init.sql\n", prefix + "002_users.sql\n", prefix + "old/\n"},
+			complete(t, nil, "migrate", "init", prefix))
+		assert.Equal(t, []string{prefix + "002_users.sql\n"}, complete(t, nil, "migrate", "init", prefix+"002"))
+		assert.NotContains(t, complete(t, nil, "migrate", prefix), prefix+"001_init.sql\n",
+			"only the second arg completes files")
+	})
+
+	t.Run("caches the values of functions for the session", func(t *testing.T) {
+		cacheDir := t.TempDir()
+		opts := []sindrtest.TestOption{
+			sindrtest.WithCacheDir(cacheDir),
+			sindrtest.WithDirectory(t.TempDir()),
+			sindrtest.WithEnv("SINDR_COMPLETION_SESSION", "1234"),
+		}
+		assert.Equal(t, []string{"eu-north-1\n", "us-east-1\n"}, complete(t, opts, "deploy", "--region", ""))
+		assert.FileExists(t, filepath.Join(cacheDir, "completions", "1234.json"))
+
+		script = strings.Replace(script, `"eu-north-1", `, "", 1)
+		assert.Equal(t, []string{"eu-north-1\n", "us-east-1\n"}, complete(t, opts, "deploy", "--region", ""))
+		assert.Equal(t, []string{"us-east-1\n"}, complete(t, nil, "deploy", "--region", ""))
+
+		otherProject := []sindrtest.TestOption{
+			sindrtest.WithCacheDir(cacheDir),
+			sindrtest.WithDirectory(t.TempDir()),
+			sindrtest.WithEnv("SINDR_COMPLETION_SESSION", "1234"),
+		}
+		assert.Equal(t, []string{"us-east-1\n"}, complete(t, otherProject, "deploy", "--region", ""),
+			"the values are cached per Starlark file")
+	})
+
+	t.Run("rejects completing bool flags", func(t *testing.T) {
+		sindrtest.Test(t, `bool_flag(name="force", complete=["true"])`,
+			sindrtest.ShouldFailWith("complete: bool flags don't take values"))
+	})
+}
+
+func TestCompletionSnapshot(t *testing.T) {
+	dir, cacheDir := t.TempDir(), t.TempDir()
+	counter := filepath.Join(t.TempDir(), "runs")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "lib.star"), []byte("usage = 'Build it'\n"), 0o600))
+
+	script := `
+load("lib.star", "usage")
+
+shell('echo ran >> ` + counter + `')
+
+def list_regions():
+    return ["eu-north-1"]
+
+def action(ctx):
+    pass
+
+cli(name="TestApp")
+command(name="build", usage=usage, action=action)
+command(name="deploy", action=action, flags=[string_flag(name="region", complete=list_regions)])
+`
+
+	complete := func(t *testing.T, script string, opts ...sindrtest.TestOption) []string {
+		t.Helper()
+		writer := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, script, append(opts,
+			sindrtest.WithDirectory(dir),
+			sindrtest.WithCacheDir(cacheDir),
+			sindrtest.WithWriter(writer))...)
+
+		// without the logs of running the Starlark file
+		var completions []string
+		for _, w := range writer.Writes {
+			if !strings.HasPrefix(w, "test.star:") {
+				completions = append(completions, w)
+			}
+		}
+		return completions
+	}
+	runs := func(t *testing.T) int {
+		t.Helper()
+		b, err := os.ReadFile(counter) // #nosec G304
+		require.NoError(t, err)
+		return strings.Count(string(b), "ran")
+	}
+
+	t.Run("completes from the snapshot without running the Starlark file", func(t *testing.T) {
+		first := complete(t, script, sindrtest.WithArgs("__complete", "--", "sindr", "b"))
+		assert.Equal(t, []string{"build\tBuild it\n"}, first)
+		assert.Equal(t, 1, runs(t))
+
+		assert.Equal(t, first, complete(t, script, sindrtest.WithArgs("__complete", "--", "sindr", "b")))
+		assert.Equal(t, 1, runs(t))
+	})
+
+	t.Run("runs the Starlark file again when a loaded file changes", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "lib.star"), []byte("usage = 'Builds'\n"), 0o600))
+		assert.Equal(t, []string{"build\tBuilds\n"},
+			complete(t, script, sindrtest.WithArgs("__complete", "--", "sindr", "b")))
+		assert.Equal(t, 2, runs(t))
+	})
+
+	t.Run("runs the Starlark file to call completion functions", func(t *testing.T) {
+		opts := []sindrtest.TestOption{
+			sindrtest.WithArgs("__complete", "--", "sindr", "deploy", "--region", ""),
+			sindrtest.WithEnv("SINDR_COMPLETION_SESSION", "1234"),
+		}
+		assert.Equal(t, []string{"eu-north-1\n"}, complete(t, script, opts...))
+		assert.Equal(t, 3, runs(t))
+
+		assert.Equal(t, []string{"eu-north-1\n"}, complete(t, script, opts...))
+		assert.Equal(t, 3, runs(t), "the values are cached for the session")
+	})
+}
+
+func TestZshCompletion(t *testing.T) {
+	zsh, err := exec.LookPath("zsh")
+	if err != nil {
+		t.Skip("zsh is not installed")
+	}
+
+	writer := new(sindrtest.CollectWriter)
+	sindrtest.Test(t, `cli(name="TestApp")`, sindrtest.WithArgs("completion", "zsh"), sindrtest.WithWriter(writer))
+	completion := filepath.Join(t.TempDir(), "_sindr")
+	require.NoError(t, os.WriteFile(completion, []byte(strings.Join(writer.Writes, "")), 0o600))
+
+	// complete runs the completion for line in zsh, with compdef and _describe replaced as they only work in a
+	// completion widget, printing the completions and then the directories given to _describe.
+	complete := func(t *testing.T, line, output string) (args, completions []string) {
+		t.Helper()
+		args, out := runCompletion(t, output, zsh, "-f", "-c", `compdef() { :; }
+_describe() { print -rl -- "${(@P)3}" "${(@P)5}"; }
+source "$1"
+words=(${(z)2})
+[[ $2 == *' ' ]] && words+=('')
+CURRENT=${#words}
+_sindr`, "zsh", completion, line)
+		return args, strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	}
+
+	t.Run("completes with descriptions", func(t *testing.T) {
+		args, completions := complete(t, "sindr deploy ",
+			`staging\tDeploy to staging\nproduction\tDeploy to production\n`)
+		assert.Equal(t, []string{"__complete", "--", "sindr", "deploy", ""}, args)
+		assert.Equal(t, []string{"staging:Deploy to staging", "production:Deploy to production"}, completions)
+	})
+
+	t.Run("passes the word being completed", func(t *testing.T) {
+		args, completions := complete(t, "sindr deploy st", `staging\n`)
+		assert.Equal(t, []string{"__complete", "--", "sindr", "deploy", "st"}, args)
+		assert.Equal(t, []string{"staging"}, completions)
+	})
+
+	t.Run("escapes colons and completes directories separately", func(t *testing.T) {
+		_, completions := complete(t, "sindr build ", `web:dev\tThe web app\nsrc/\n`)
+		assert.Equal(t, []string{"web\\:dev:The web app", "src/"}, completions)
+	})
+}
+
+// runCompletion runs a completion script with the shell, with a sindr that returns output. It returns the arguments
+// sindr was called with and what the shell printed.
+func runCompletion(t *testing.T, output, shell string, shellArgs ...string) (args []string, out string) {
+	t.Helper()
+	bin, argsFile := t.TempDir(), filepath.Join(t.TempDir(), "args")
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "sindr"), []byte(`#!/bin/sh
+printf '%s\n' "$@" > `+argsFile+`
+printf '%b' '`+output+`'
+`), 0o700)) // #nosec G306
+
+	cmd := exec.Command(shell, shellArgs...) // #nosec G204
+	cmd.Dir = bin
+	cmd.Env = append(os.Environ(), "PATH="+bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	b, err := cmd.Output()
+	require.NoError(t, err)
+
+	a, err := os.ReadFile(argsFile) // #nosec G304
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSuffix(string(a), "\n"), "\n"), string(b)
 }
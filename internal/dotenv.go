@@ -9,6 +9,7 @@ import (
 	"go.starlark.net/starlark"
 
 	"github.com/mbark/sindr/internal/logger"
+	"github.com/mbark/sindr/internal/policy"
 )
 
 func SindrDotenv(
@@ -17,9 +18,13 @@ func SindrDotenv(
 	args starlark.Tuple,
 	kwargs []starlark.Tuple,
 ) (starlark.Value, error) {
-	var list *starlark.List
+	var list, secretsList *starlark.List
 	var overload bool
-	err := starlark.UnpackArgs("dotenv", args, kwargs, "files?", &list, "overload?", &overload)
+	err := starlark.UnpackArgs("dotenv", args, kwargs,
+		"files?", &list,
+		"overload?", &overload,
+		"secrets?", &secretsList,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -32,11 +37,24 @@ func SindrDotenv(
 		return nil, err
 	}
 
+	secrets, err := fromList[string](secretsList, func(value starlark.Value) (string, error) {
+		s, err := cast[starlark.String](value)
+		return string(s), err
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	if len(files) == 0 {
 		files = []string{".env"}
 	}
+	for _, file := range files {
+		if err := policy.CheckPath(thread, "dotenv", file, false); err != nil {
+			return nil, err
+		}
+	}
 
-	logger := logger.WithStack(thread.CallStack())
+	logger := GetLogger(thread)
 	logger.Log(
 		lipgloss.NewStyle().Bold(true).Render("loading " + strings.Join(files, ", ")),
 	)
@@ -46,31 +64,43 @@ func SindrDotenv(
 	}
 
 	res := loadEnvMap(envMap, overload)
+	for _, key := range secrets {
+		// the value might not be the one in the file if it was already set
+		if value, ok := os.LookupEnv(key); ok {
+			NewSecret(value)
+		}
+	}
+	logEnvResult(logger, res)
+
+	return starlark.None, err
+}
+
+// logEnvResult logs the environment variables that were exported.
+func logEnvResult(l logger.Interface, res loadResult) {
 	if len(res.exported) > 0 {
-		logger.LogVerbose(
+		l.LogVerbose(
 			lipgloss.NewStyle().Bold(true).Faint(true).Render("export"),
 			lipgloss.NewStyle().Faint(true).Render(strings.Join(res.exported, " ")),
 		)
 	}
 	if len(res.overloaded) > 0 {
-		logger.LogVerbose(
+		l.LogVerbose(
 			lipgloss.NewStyle().Bold(true).Faint(true).Render("overload"),
 			lipgloss.NewStyle().Faint(true).Render(strings.Join(res.overloaded, " ")),
 		)
 	}
 	if len(res.skipped) > 0 {
-		logger.LogVerbose(
+		l.LogVerbose(
 			lipgloss.NewStyle().Bold(true).Faint(true).Render("skip"),
 			lipgloss.NewStyle().Faint(true).Render(strings.Join(res.skipped, " ")),
 		)
 	}
 	if len(res.exported) == 0 && len(res.overloaded) == 0 && len(res.skipped) == 0 {
-		logger.Log(
+		l.Log(
 			lipgloss.NewStyle().Bold(true).Faint(true).Render("no environment exported"),
 		)
 	}
 
-	return starlark.None, err
 }
 
 type loadResult struct {
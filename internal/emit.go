@@ -0,0 +1,33 @@
+package internal
+
+import (
+	"strings"
+
+	"go.starlark.net/starlark"
+)
+
+// SindrEmit writes its arguments as a line of data to stdout, like print() but kept apart from the logs so that the
+// output of a command can be piped to other programs.
+func SindrEmit(
+	thread *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	sep := " "
+	if err := starlark.UnpackArgs("emit", nil, kwargs, "sep?", &sep); err != nil {
+		return nil, err
+	}
+
+	values := make([]string, args.Len())
+	for i, arg := range args {
+		if s, ok := starlark.AsString(arg); ok {
+			values[i] = s
+		} else {
+			values[i] = arg.String()
+		}
+	}
+
+	GetLogger(thread).Emit(strings.Join(values, sep))
+	return starlark.None, nil
+}
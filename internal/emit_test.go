@@ -0,0 +1,49 @@
+package internal_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mbark/sindr/internal/logger"
+	"github.com/mbark/sindr/internal/sindrtest"
+)
+
+func TestEmit(t *testing.T) {
+	t.Run("writes data to the output", func(t *testing.T) {
+		logs, output := new(sindrtest.CollectWriter), new(sindrtest.CollectWriter)
+		sindrtest.Test(t, `
+def test_action(ctx):
+    shell('echo logged')
+    emit('a', 1, [2])
+    emit('b', 'c', sep=',')
+
+cli(name="TestEmit")
+command(name="test", action=test_action)
+`, sindrtest.WithLogger(logger.Logger{}), sindrtest.WithWriter(logs), sindrtest.WithOutput(output))
+
+		assert.Equal(t, []string{"a 1 [2]\n", "b,c\n"}, output.Writes)
+		assert.Contains(t, strings.Join(logs.Writes, ""), "logged")
+	})
+
+	t.Run("only writes data and errors when quiet", func(t *testing.T) {
+		logs, output := new(sindrtest.CollectWriter), new(sindrtest.CollectWriter)
+		sindrtest.Test(t, `
+def test_action(ctx):
+    print('hidden')
+    shell('echo hidden')
+    emit('shown')
+
+cli(name="TestEmit")
+command(name="test", action=test_action)
+`,
+			sindrtest.WithLogger(logger.Logger{}),
+			sindrtest.WithWriter(logs),
+			sindrtest.WithOutput(output),
+			sindrtest.WithArgs("--quiet", "test"))
+
+		assert.Equal(t, []string{"shown\n"}, output.Writes)
+		assert.Empty(t, logs.Writes)
+	})
+}
@@ -2,14 +2,17 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"go.starlark.net/starlark"
 
-	"github.com/mbark/sindr/internal/logger"
+	"github.com/mbark/sindr/internal/trace"
 )
 
 func SindrExec(
@@ -19,23 +22,44 @@ func SindrExec(
 	kwargs []starlark.Tuple,
 ) (starlark.Value, error) {
 	relevantKwargs, otherKwargs := splitKwargs(kwargs,
-		"bin", "command", "args", "prefix", "no_output")
+		append([]string{"bin", "command", "args", "interpreter"}, processKwargs...)...)
 
-	var bin, command, prefix string
+	var bin, command string
 	var binArgs *starlark.List
-	var noOutput bool
-	if err := starlark.UnpackArgs("exec", args, relevantKwargs,
-		"bin", &bin,
-		"command", &command,
+	var interpreter starlark.Value
+	opts := newProcessOptions()
+	if err := starlark.UnpackArgs("exec", args, relevantKwargs, append([]any{
+		"bin?", &bin,
+		"command?", &command,
 		"args?", &binArgs,
-		"prefix?", &prefix,
-		"no_output?", &noOutput,
-	); err != nil {
+		"interpreter?", &interpreter,
+	}, opts.unpackPairs()...)...); err != nil {
 		return nil, err
 	}
+	if err := opts.checkPolicy(thread, "exec"); err != nil {
+		return nil, err
+	}
+	prefix := opts.prefix
+	logger := GetLogger(thread)
 	if binArgs == nil {
 		binArgs = new(starlark.List)
 	}
+	// exec('echo hi') only passes the command, which is then run with the configured shell
+	if command == "" && args.Len() == 1 {
+		bin, command = "", bin
+	}
+	if command == "" {
+		return nil, errors.New("exec: missing argument for command")
+	}
+
+	interpreterArgs := []string{bin}
+	if bin == "" {
+		shell, err := resolveShell(thread, interpreter)
+		if err != nil {
+			return nil, err
+		}
+		interpreterArgs = scriptInterpreter(shell)
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -51,16 +75,13 @@ func SindrExec(
 		}
 	}()
 
-	if prefix != "" {
-		logger.LogVerbose(prefixStyle.Render(prefix), commandStyleVerbose.Render(command))
-	} else {
-		logger.LogVerbose(commandStyleVerbose.Render(command))
-	}
-
 	command, err = evaluateTemplateString(command, thread, otherKwargs)
 	if err != nil {
 		return nil, err
 	}
+	logScript(logger, prefix, command)
+	firstLine, _, _ := strings.Cut(strings.TrimSpace(command), "\n")
+	span := trace.Begin(thread, "exec", firstLine)
 
 	file := filepath.Join(tmpdir, "exec")
 	err = os.WriteFile(file, []byte(command), 0o644)
@@ -68,18 +89,32 @@ func SindrExec(
 		return nil, fmt.Errorf("create file %s to exec: %w", file, err)
 	}
 
-	logger := logger.WithStack(thread.CallStack())
-	cmd := exec.CommandContext(ctx, "/usr/bin/env", bin, file) // #nosec G204
+	newCmd := func() *exec.Cmd {
+		return exec.CommandContext(ctx, "/usr/bin/env", append(interpreterArgs, file)...) // #nosec G204
+	}
+	logInterpreter(logger, prefix, interpreterArgs)
 	if prefix != "" {
-		logger.LogVerbose(prefixStyle.Render(prefix), commandStyle.Render("$ "+cmd.String()))
+		logger.LogVerbose(renderPrefix(prefix), commandStyle.Render("$ "+newCmd().String()))
 	} else {
-		logger.LogVerbose(commandStyle.Render("$ " + cmd.String()))
+		logger.LogVerbose(commandStyle.Render("$ " + newCmd().String()))
 	}
 
-	res, err := StartShellCmd(logger, cmd, prefix, noOutput)
+	res, err := opts.start(logger, newCmd)
 	if err != nil {
 		return nil, fmt.Errorf("start shell cmd failed: %w", err)
 	}
 
+	res.Command = command
+	span.End(res.traceArgs())
+	logEnd(logger, prefix, res)
 	return res, nil
 }
+
+// scriptInterpreter turns a shell interpreter like ["bash", "-euo", "pipefail", "-c"] into one that runs a script
+// file, by dropping the trailing "-c".
+func scriptInterpreter(shell []string) []string {
+	if len(shell) > 1 && shell[len(shell)-1] == "-c" {
+		shell = shell[:len(shell)-1]
+	}
+	return slices.Clone(shell)
+}
@@ -425,3 +425,39 @@ command(name="test", action=test_action)
 `)
 	})
 }
+
+func TestExecInterpreter(t *testing.T) {
+	t.Run("runs the command with the default shell when no bin is given", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = exec('echo "no bin"')
+    assert_equals('no bin', result.stdout)
+
+cli(name="TestExecInterpreter")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("uses the interpreter set on cli", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = exec(command='''arr=(a b c)
+echo ${#arr[@]}''')
+    assert_equals('3', result.stdout)
+
+cli(name="TestExecInterpreter", shell=["bash", "-euo", "pipefail", "-c"])
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("interpreter on the call takes precedence", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = exec(command='[[ 1 == 1 ]] && echo bash', interpreter=['bash'])
+    assert_equals('bash', result.stdout)
+
+cli(name="TestExecInterpreter")
+command(name="test", action=test_action)
+`)
+	})
+}
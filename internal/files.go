@@ -6,6 +6,8 @@ import (
 	"path/filepath"
 
 	"go.starlark.net/starlark"
+
+	"github.com/mbark/sindr/internal/policy"
 )
 
 // SindrNewestTS finds the newest modification time among files matching the given globs.
@@ -15,7 +17,7 @@ func SindrNewestTS(
 	args starlark.Tuple,
 	kwargs []starlark.Tuple,
 ) (starlark.Value, error) {
-	return findExtremeTimestamp(args, "newest_ts()", true)
+	return findExtremeTimestamp(thread, args, "newest_ts", true)
 }
 
 // SindrOldestTS finds the oldest modification time among files matching the given globs.
@@ -25,18 +27,19 @@ func SindrOldestTS(
 	args starlark.Tuple,
 	kwargs []starlark.Tuple,
 ) (starlark.Value, error) {
-	return findExtremeTimestamp(args, "oldest_ts()", false)
+	return findExtremeTimestamp(thread, args, "oldest_ts", false)
 }
 
 // findExtremeTimestamp finds either the newest or oldest timestamp based on the findNewest flag.
 func findExtremeTimestamp(
+	thread *starlark.Thread,
 	args starlark.Tuple,
 	fnName string,
 	findNewest bool,
 ) (starlark.Value, error) {
 	if args.Len() != 1 {
 		return nil, errors.New(
-			fnName + " requires exactly 1 argument (a glob pattern or list of patterns)",
+			fnName + "() requires exactly 1 argument (a glob pattern or list of patterns)",
 		)
 	}
 
@@ -55,6 +58,9 @@ func findExtremeTimestamp(
 		}
 
 		for _, match := range matches {
+			if err := policy.CheckPath(thread, fnName, match, false); err != nil {
+				return nil, err
+			}
 			info, err := os.Stat(match)
 			if err != nil {
 				continue // skip files that can't be stat'd
@@ -107,6 +113,9 @@ func SindrGlob(
 		}
 
 		for _, match := range matches {
+			if err := policy.CheckPath(thread, "glob", match, false); err != nil {
+				return nil, err
+			}
 			info, err := os.Stat(match)
 			if err != nil {
 				continue // skip files that can't be stat'd
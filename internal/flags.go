@@ -14,19 +14,46 @@ func SindrStringFlag(
 	args starlark.Tuple,
 	kwargs []starlark.Tuple,
 ) (starlark.Value, error) {
-	return sindrFlag[starlark.String](
+	choicesKwargs, kwargs := splitKwargs(kwargs, "choices")
+	var choicesList *starlark.List
+	if err := starlark.UnpackArgs("string_flag", nil, choicesKwargs, "choices?", &choicesList); err != nil {
+		return nil, err
+	}
+	choices, err := parseChoices(choicesList)
+	if err != nil {
+		return nil, err
+	}
+
+	flag, err := sindrFlag[starlark.String](
 		thread,
 		fn,
 		args,
 		kwargs,
 		func(name, usage string, defaultValue starlark.String) (cli.Flag, error) {
-			return &cli.StringFlag{
+			f := &cli.StringFlag{
 				Name:  name,
-				Usage: usage,
+				Usage: withChoices(usage, choices),
 				Value: string(defaultValue),
-			}, nil
+			}
+			if choices != nil {
+				if defaultValue != "" {
+					if err := checkChoice(choices, string(defaultValue)); err != nil {
+						return nil, fmt.Errorf("default: %w", err)
+					}
+				}
+				f.Validator = func(value string) error { return checkChoice(choices, value) }
+			}
+			return f, nil
 		},
 	)
+	if err != nil {
+		return nil, err
+	}
+
+	if flag.complete == nil && choices != nil {
+		flag.complete = &Completer{values: choices}
+	}
+	return flag, nil
 }
 
 func SindrBoolFlag(
@@ -135,18 +162,20 @@ func SindrIntSliceFlag(
 }
 
 func sindrFlag[T starlark.Value](
-	_ *starlark.Thread,
+	thread *starlark.Thread,
 	_ *starlark.Builtin,
 	args starlark.Tuple,
 	kwargs []starlark.Tuple,
 	newFlag func(name, usage string, defaultValue T) (cli.Flag, error),
-) (starlark.Value, error) {
+) (*Flag, error) {
 	var name, usage string
 	var defaultValue T
+	var complete starlark.Value
 	if err := starlark.UnpackArgs("string_flag", args, kwargs,
 		"name", &name,
 		"usage?", &usage,
 		"default?", &defaultValue,
+		"complete?", &complete,
 	); err != nil {
 		return nil, err
 	}
@@ -155,7 +184,18 @@ func sindrFlag[T starlark.Value](
 	if err != nil {
 		return nil, err
 	}
-	return NewFlag(f), nil
+
+	completer, err := parseCompleter(thread, complete)
+	if err != nil {
+		return nil, fmt.Errorf("complete: %w", err)
+	}
+	if completer != nil && !flagTakesValue(f) {
+		return nil, errors.New("complete: bool flags don't take values")
+	}
+
+	flag := NewFlag(f)
+	flag.complete = completer
+	return flag, nil
 }
 
 func processFlags(flagsList *starlark.List, cmd *Command) error {
@@ -170,6 +210,11 @@ func processFlags(flagsList *starlark.List, cmd *Command) error {
 		}
 
 		cmd.Command.Flags = append(cmd.Command.Flags, flag.flag)
+		if flag.complete != nil {
+			for _, n := range flag.flag.Names() {
+				commandCompleters(cmd.Command).flags[normalizeFlagSpelling(n)] = flag.complete
+			}
+		}
 	}
 
 	return nil
@@ -178,7 +223,8 @@ func processFlags(flagsList *starlark.List, cmd *Command) error {
 var _ starlark.Value = (*Flag)(nil)
 
 type Flag struct {
-	flag cli.Flag
+	flag     cli.Flag
+	complete *Completer
 }
 
 func NewFlag(flag cli.Flag) *Flag {
@@ -0,0 +1,314 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/urfave/cli/v3"
+
+	"github.com/mbark/sindr/internal/logger"
+)
+
+var (
+	historyNumberStyle = lipgloss.NewStyle().Faint(true)
+	historyTimeStyle   = lipgloss.NewStyle().Faint(true)
+	rerunStyle         = lipgloss.NewStyle().Foreground(lipgloss.ANSIColor(ansi.Magenta)).Bold(true)
+
+	// historyLimit is how many invocations are kept in the history.
+	historyLimit = 500
+	// excerptLines is how many lines of output are kept for each invocation.
+	excerptLines = 20
+)
+
+// HistoryFile is the file the history is stored in, in the cache directory.
+func HistoryFile(cacheDir string) string {
+	return filepath.Join(cacheDir, "history.jsonl")
+}
+
+// HistoryEntry is an invocation of sindr, with everything needed to run it again.
+type HistoryEntry struct {
+	// N is the number of the entry, counting backwards from the latest invocation which is 1.
+	N    int       `json:"n"`
+	Time time.Time `json:"time"`
+	// Args are the arguments sindr was run with, without the name of the program.
+	Args       []string        `json:"args"`
+	Command    string          `json:"command"`
+	Flags      []logger.Arg    `json:"flags,omitempty"`
+	Arguments  []logger.Arg    `json:"arguments,omitempty"`
+	Positional []string        `json:"positional,omitempty"`
+	Cwd        string          `json:"cwd"`
+	Success    bool            `json:"success"`
+	Error      string          `json:"error,omitempty"`
+	Duration   logger.Duration `json:"duration_ms"`
+	// Excerpt is the last lines of output of the processes run.
+	Excerpt []string `json:"excerpt,omitempty"`
+}
+
+// History records an invocation from the events of the command run.
+type History struct {
+	mu      sync.Mutex
+	ran     bool
+	entry   HistoryEntry
+	excerpt []string
+}
+
+// NewHistory starts recording an invocation of sindr with args, run from cwd.
+func NewHistory(args []string, cwd string) *History {
+	return &History{entry: HistoryEntry{Time: time.Now(), Args: args, Cwd: cwd}}
+}
+
+// Handle records the command run and its output.
+func (h *History) Handle(e logger.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch e := e.(type) {
+	case logger.CommandStart:
+		h.ran = true
+		h.entry.Command = strings.Join(e.Path, " ")
+		h.entry.Flags = e.Flags
+		h.entry.Arguments = e.Args
+		h.entry.Positional = e.Positional
+	case logger.ShellOutput:
+		h.excerpt = append(h.excerpt, ansi.Strip(e.Line))
+		if len(h.excerpt) > excerptLines {
+			h.excerpt = h.excerpt[len(h.excerpt)-excerptLines:]
+		}
+	}
+}
+
+// Save appends the invocation to the history in file, if a command was run.
+func (h *History) Save(file string, runErr error) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.ran {
+		return nil
+	}
+
+	entry := h.entry
+	// unlike the events recorded, the arguments and error haven't had any secrets redacted
+	entry.Args = mapList(entry.Args, logger.Redact)
+	entry.Success = runErr == nil
+	if runErr != nil {
+		entry.Error = logger.Redact(runErr.Error())
+	}
+	entry.Duration = logger.Duration(time.Since(entry.Time))
+	entry.Excerpt = h.excerpt
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshal history: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o750); err != nil {
+		return fmt.Errorf("history: %w", err)
+	}
+
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("open history: %w", err)
+	}
+	_, err = f.Write(append(b, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("write history: %w", err)
+	}
+
+	return trimHistory(file)
+}
+
+// trimHistory drops the oldest entries once there are twice as many as are kept, to not rewrite the file every time.
+func trimHistory(file string) error {
+	b, err := os.ReadFile(file) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("read history: %w", err)
+	}
+
+	lines := bytes.SplitAfter(b, []byte("\n"))
+	if len(lines) <= 2*historyLimit {
+		return nil
+	}
+
+	// the trimmed history is written next to it and renamed, to not lose it if sindr is stopped while writing
+	kept := bytes.Join(lines[len(lines)-historyLimit-1:], nil)
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*")
+	if err != nil {
+		return fmt.Errorf("trim history: %w", err)
+	}
+	_, err = tmp.Write(kept)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("trim history: %w", err)
+	}
+	return nil
+}
+
+// LoadHistory reads the history in file, with the latest invocation first.
+func LoadHistory(file string) ([]HistoryEntry, error) {
+	f, err := os.Open(file) // #nosec G304
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open history: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// skip entries that were only partially written
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read history: %w", err)
+	}
+
+	slices.Reverse(entries)
+	if len(entries) > historyLimit {
+		entries = entries[:historyLimit]
+	}
+	for i := range entries {
+		entries[i].N = i + 1
+	}
+	return entries, nil
+}
+
+// Rerun returns the entry to run again for the arguments given to rerun, which is either the number of the entry or
+// nothing for the latest one.
+func Rerun(file string, args []string) (*HistoryEntry, error) {
+	n := 1
+	if len(args) > 0 {
+		var err error
+		n, err = strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("rerun: invalid history number %q", args[0])
+		}
+	}
+
+	entries, err := LoadHistory(file)
+	if err != nil {
+		return nil, err
+	}
+	if n > len(entries) {
+		return nil, fmt.Errorf("rerun: no command %d in the history, which has %d commands", n, len(entries))
+	}
+	return &entries[n-1], nil
+}
+
+// RerunError is returned to have an invocation from the history run again, once the current one is done.
+type RerunError struct {
+	Entry *HistoryEntry
+}
+
+func (e *RerunError) Error() string {
+	return "rerun " + strings.Join(e.Entry.Args, " ")
+}
+
+// HistoryCommands creates the history and rerun commands, for sindr run from cwd. The rerun command returns a
+// RerunError, for the invocation to be run again with its arguments.
+func HistoryCommands(file, cwd string) []*cli.Command {
+	return []*cli.Command{
+		{
+			Name:      "history",
+			Usage:     "Shows the commands run, with the latest first",
+			ArgsUsage: "[filter]",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{Name: "json", Usage: "print the history as JSON"},
+				&cli.BoolFlag{Name: "failed", Usage: "only show commands that failed"},
+			},
+			Action: func(ctx context.Context, command *cli.Command) error {
+				return historyAction(file, cwd, command)
+			},
+		},
+		{
+			// also run as "!!", which isn't an alias to not have it completed as it's expanded by shells
+			Name:      "rerun",
+			Usage:     "Runs a command from the history again, with the same flags and arguments",
+			ArgsUsage: "[N]",
+			Action: func(ctx context.Context, command *cli.Command) error {
+				entry, err := Rerun(file, command.Args().Slice())
+				if err != nil {
+					return err
+				}
+				return &RerunError{Entry: entry}
+			},
+		},
+	}
+}
+
+func historyAction(file, cwd string, command *cli.Command) error {
+	entries, err := LoadHistory(file)
+	if err != nil {
+		return err
+	}
+
+	filter := strings.Join(command.Args().Slice(), " ")
+	entries = slices.DeleteFunc(entries, func(e HistoryEntry) bool {
+		return (command.Bool("failed") && e.Success) || !strings.Contains(strings.Join(e.Args, " "), filter)
+	})
+
+	if command.Bool("json") {
+		if entries == nil {
+			entries = []HistoryEntry{}
+		}
+		b, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshal history: %w", err)
+		}
+		logger.Emit(string(b))
+		return nil
+	}
+
+	width := len(strconv.Itoa(len(entries)))
+	for _, e := range entries {
+		icon := successStyle.Render("✓")
+		if !e.Success {
+			icon = failedStyle.Render("✗")
+		}
+
+		line := fmt.Sprintf("%s %s %s %s %s",
+			historyNumberStyle.Render(fmt.Sprintf("%*d", width, e.N)),
+			historyTimeStyle.Render(e.Time.Local().Format(time.DateTime)),
+			icon,
+			strings.Join(e.Args, " "),
+			formatElapsed(time.Duration(e.Duration)),
+		)
+		if e.Cwd != cwd {
+			line += " " + historyTimeStyle.Render("in "+e.Cwd)
+		}
+		logger.Emit(line)
+	}
+	return nil
+}
+
+// RenderRerun renders the invocation being run again.
+func RenderRerun(e *HistoryEntry) string {
+	return historyNumberStyle.Render("rerunning") + " " + rerunStyle.Render(strings.Join(e.Args, " "))
+}
@@ -0,0 +1,135 @@
+package internal_test
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mbark/sindr/internal"
+	"github.com/mbark/sindr/internal/logger"
+	"github.com/mbark/sindr/internal/sindrtest"
+)
+
+func TestHistory(t *testing.T) {
+	script := `
+def deploy(ctx):
+    shell('echo deploying to {{.env}}', env=ctx.flags.env)
+    emit(ctx.flags.env)
+
+def broken(ctx):
+    fail('broken')
+
+cli(name="TestHistory")
+command(name="deploy", action=deploy, flags=[string_flag("env", default="dev")])
+command(name="broken", action=broken)
+`
+
+	t.Run("lists the commands run", func(t *testing.T) {
+		cacheDir := t.TempDir()
+		sindrtest.Test(t, script, sindrtest.WithCacheDir(cacheDir), sindrtest.WithArgs("deploy", "--env", "prod"))
+		sindrtest.Test(t, script, sindrtest.WithCacheDir(cacheDir), sindrtest.WithArgs("broken"),
+			sindrtest.ShouldFail())
+
+		output := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, script, sindrtest.WithCacheDir(cacheDir), sindrtest.WithArgs("history", "--json"),
+			sindrtest.WithLogger(logger.Logger{}), sindrtest.WithWriter(io.Discard), sindrtest.WithOutput(output))
+
+		var entries []struct {
+			N       int      `json:"n"`
+			Args    []string `json:"args"`
+			Command string   `json:"command"`
+			Flags   []struct {
+				Name  string `json:"name"`
+				Value any    `json:"value"`
+			} `json:"flags"`
+			Success bool     `json:"success"`
+			Error   string   `json:"error"`
+			Excerpt []string `json:"excerpt"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(strings.Join(output.Writes, "")), &entries))
+		require.Len(t, entries, 2, "the history command itself isn't recorded")
+
+		assert.Equal(t, 1, entries[0].N)
+		assert.Equal(t, []string{"broken"}, entries[0].Args)
+		assert.False(t, entries[0].Success)
+		assert.Contains(t, entries[0].Error, "broken")
+
+		assert.Equal(t, 2, entries[1].N)
+		assert.Equal(t, []string{"deploy", "--env", "prod"}, entries[1].Args)
+		assert.Equal(t, "deploy", entries[1].Command)
+		assert.True(t, entries[1].Success)
+		assert.Contains(t, entries[1].Flags, struct {
+			Name  string `json:"name"`
+			Value any    `json:"value"`
+		}{Name: "env", Value: "prod"})
+		assert.Equal(t, []string{"deploying to prod"}, entries[1].Excerpt)
+
+		failed := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, script, sindrtest.WithCacheDir(cacheDir), sindrtest.WithArgs("history", "--failed"),
+			sindrtest.WithLogger(logger.Logger{}), sindrtest.WithWriter(io.Discard), sindrtest.WithOutput(failed))
+		require.Len(t, failed.Writes, 1)
+		assert.Contains(t, failed.Writes[0], "✗ broken")
+	})
+
+	t.Run("reruns a command with the same flags", func(t *testing.T) {
+		cacheDir := t.TempDir()
+		sindrtest.Test(t, script, sindrtest.WithCacheDir(cacheDir), sindrtest.WithArgs("deploy", "--env", "staging"))
+		sindrtest.Test(t, script, sindrtest.WithCacheDir(cacheDir), sindrtest.WithArgs("deploy"))
+
+		output := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, script, sindrtest.WithCacheDir(cacheDir), sindrtest.WithArgs("rerun", "2"),
+			sindrtest.WithLogger(logger.Logger{}), sindrtest.WithWriter(io.Discard), sindrtest.WithOutput(output))
+		assert.Equal(t, []string{"staging\n"}, output.Writes)
+
+		output = new(sindrtest.CollectWriter)
+		sindrtest.Test(t, script, sindrtest.WithCacheDir(cacheDir), sindrtest.WithArgs("!!"),
+			sindrtest.WithLogger(logger.Logger{}), sindrtest.WithWriter(io.Discard), sindrtest.WithOutput(output))
+		assert.Equal(t, []string{"staging\n"}, output.Writes, "the rerun is the latest command")
+	})
+
+	t.Run("fails to rerun commands not in the history", func(t *testing.T) {
+		sindrtest.Test(t, script, sindrtest.WithArgs("rerun", "3"), sindrtest.ShouldFail())
+	})
+
+	t.Run("trims the history", func(t *testing.T) {
+		cacheDir := t.TempDir()
+		file := internal.HistoryFile(cacheDir)
+		require.NoError(t, os.MkdirAll(filepath.Dir(file), 0o700))
+		entry := `{"args":["deploy"],"success":true}` + "\n"
+		require.NoError(t, os.WriteFile(file, []byte(strings.Repeat(entry, 1000)), 0o600))
+
+		sindrtest.Test(t, script, sindrtest.WithCacheDir(cacheDir), sindrtest.WithArgs("deploy"))
+
+		b, err := os.ReadFile(file) // #nosec G304
+		require.NoError(t, err)
+		assert.Equal(t, 500, strings.Count(string(b), "\n"))
+		tmp, err := filepath.Glob(file + ".*")
+		require.NoError(t, err)
+		assert.Empty(t, tmp, "the trimmed history replaces the file")
+	})
+
+	t.Run("shows the help of rerun", func(t *testing.T) {
+		writer := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, script, sindrtest.WithArgs("rerun", "--help"), sindrtest.WithWriter(writer))
+		assert.Contains(t, strings.Join(writer.Writes, ""), "Runs a command from the history again")
+	})
+
+	t.Run("runs a rerun command defined in the Starlark file", func(t *testing.T) {
+		output := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, `
+def rerun(ctx):
+    emit('own rerun ' + ctx.args.job)
+
+cli(name="TestHistory")
+command(name="rerun", action=rerun, args=[string_arg("job")])
+`, sindrtest.WithArgs("rerun", "nightly"), sindrtest.WithLogger(logger.Logger{}), sindrtest.WithWriter(io.Discard),
+			sindrtest.WithOutput(output))
+		assert.Equal(t, []string{"own rerun nightly\n"}, output.Writes)
+	})
+}
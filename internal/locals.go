@@ -17,7 +17,8 @@ func InitialiseLocals(thread *starlark.Thread) (*CLI, *sync.WaitGroup) {
 			Command: &cli.Command{
 				EnableShellCompletion:           true,
 				ConfigureShellCompletionCommand: ConfigureShellCompletionCommand,
-				Writer:                          logger.Writer,
+				Writer:                          logger.Output,
+				ErrWriter:                       logger.Writer,
 			},
 		},
 	}
@@ -27,6 +28,18 @@ func InitialiseLocals(thread *starlark.Thread) (*CLI, *sync.WaitGroup) {
 	return sindrCLI, wg
 }
 
+// newChildThread creates a thread for running a function concurrently with thread, carrying over the thread locals
+// so that builtins like shell() behave the same in both.
+func newChildThread(thread *starlark.Thread, name string) *starlark.Thread {
+	child := &starlark.Thread{Name: name, Load: thread.Load, Print: thread.Print}
+	for _, key := range []string{"cli", "wg", "ctx", "logger"} {
+		if v := thread.Local(key); v != nil {
+			child.SetLocal(key, v)
+		}
+	}
+	return child
+}
+
 func getSindrCLI(thread *starlark.Thread) (*CLI, error) {
 	cliValue := thread.Local("cli")
 	sindrCLI, ok := cliValue.(*CLI)
@@ -46,3 +59,13 @@ func getWaitGroup(thread *starlark.Thread) (*sync.WaitGroup, error) {
 
 	return wg, nil
 }
+
+// GetLogger returns the logger for the thread, which is the default logger unless the thread's output is buffered,
+// like for tasks run in a pool with grouped output.
+func GetLogger(thread *starlark.Thread) logger.Interface {
+	if l, ok := thread.Local("logger").(logger.Interface); ok {
+		return l.WithStack(thread.CallStack())
+	}
+
+	return logger.WithStack(thread.CallStack())
+}
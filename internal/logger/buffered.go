@@ -0,0 +1,100 @@
+package logger
+
+import (
+	"sync"
+
+	"go.starlark.net/starlark"
+)
+
+// flushMu makes sure that buffered output is flushed without being interleaved with other flushes.
+var flushMu sync.Mutex
+
+var _ Interface = Buffered{}
+
+// Buffered holds on to everything logged until it is flushed to the logger it wraps, which allows grouping the output
+// of something running concurrently.
+type Buffered struct {
+	parent Interface
+	buf    *buffer
+}
+
+type buffer struct {
+	mu      sync.Mutex
+	entries []entry
+}
+
+type entry struct {
+	write func()
+	// data is set for entries written with Emit, which are never discarded
+	data bool
+}
+
+// NewBuffered creates a logger buffering all output until Flush is called, when it's written to parent.
+func NewBuffered(parent Interface) Buffered {
+	return Buffered{parent: parent, buf: &buffer{}}
+}
+
+func (b Buffered) add(write func()) {
+	b.buf.mu.Lock()
+	defer b.buf.mu.Unlock()
+	b.buf.entries = append(b.buf.entries, entry{write: write})
+}
+
+// Flush writes all buffered output to the wrapped logger at once.
+func (b Buffered) Flush() {
+	b.flush(false)
+}
+
+// Discard drops all buffered logs, only writing the data that was emitted.
+func (b Buffered) Discard() {
+	b.flush(true)
+}
+
+func (b Buffered) flush(dataOnly bool) {
+	b.buf.mu.Lock()
+	entries := b.buf.entries
+	b.buf.entries = nil
+	b.buf.mu.Unlock()
+
+	flushMu.Lock()
+	defer flushMu.Unlock()
+	for _, e := range entries {
+		if !dataOnly || e.data {
+			e.write()
+		}
+	}
+}
+
+func (b Buffered) WithStack(stack starlark.CallStack) Interface {
+	return Buffered{parent: b.parent.WithStack(stack), buf: b.buf}
+}
+
+func (b Buffered) Print(message string) {
+	b.add(func() { b.parent.Print(message) })
+}
+
+func (b Buffered) Emit(message string) {
+	b.buf.mu.Lock()
+	defer b.buf.mu.Unlock()
+	b.buf.entries = append(b.buf.entries, entry{write: func() { b.parent.Emit(message) }, data: true})
+}
+
+func (b Buffered) Log(messages ...string) {
+	b.add(func() { b.parent.Log(messages...) })
+}
+
+func (b Buffered) LogErr(message string, err error) {
+	b.add(func() { b.parent.LogErr(message, err) })
+}
+
+func (b Buffered) LogVerbose(messages ...string) {
+	if !DoLogVerbose {
+		return
+	}
+
+	b.add(func() { b.parent.LogVerbose(messages...) })
+}
+
+func (b Buffered) Event(e Event) {
+	b.add(func() { b.parent.Event(e) })
+}
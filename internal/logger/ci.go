@@ -0,0 +1,243 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+// The CI systems logs can be formatted for.
+const (
+	CIGitHub = "github"
+	CIGitLab = "gitlab"
+	CINone   = "none"
+)
+
+// DetectCI returns the CI system sindr is running in, or CINone if it's not running in one it knows.
+func DetectCI() string {
+	switch {
+	case os.Getenv("GITHUB_ACTIONS") == "true":
+		return CIGitHub
+	case os.Getenv("GITLAB_CI") == "true":
+		return CIGitLab
+	default:
+		return CINone
+	}
+}
+
+var _ Interface = CI{}
+
+// CI wraps a logger to show the logs of each command and process in a collapsible group, and errors as annotations
+// pointing to where in the Starlark file they happened, for CI systems to show them nicely.
+type CI struct {
+	Interface
+	system string
+	groups *ciGroups
+}
+
+type ciGroups struct {
+	mu sync.Mutex
+	// open are the names of the groups that are open, with the innermost last
+	open []string
+	// visible is whether a GitHub group is shown as open, as only one can be
+	visible bool
+	count   int
+	// shells is the number of processes running, and shell the name of the group of the one that's grouped. Only a
+	// process running by itself is grouped, as the output of processes running at the same time is interleaved.
+	shells int
+	shell  string
+}
+
+// NewCI wraps parent to format logs for the CI system, which is either CIGitHub or CIGitLab.
+func NewCI(parent Interface, system string) CI {
+	return CI{Interface: parent, system: system, groups: &ciGroups{}}
+}
+
+func (c CI) WithStack(stack starlark.CallStack) Interface {
+	return CI{Interface: c.Interface.WithStack(stack), system: c.system, groups: c.groups}
+}
+
+func (c CI) LogErr(message string, err error) {
+	c.endGroups()
+	if c.system == CIGitHub {
+		c.annotate(message, err)
+	}
+	c.Interface.LogErr(message, err)
+}
+
+func (c CI) Event(e Event) {
+	switch e := e.(type) {
+	case CommandStart:
+		c.startGroup(strings.Join(e.Path, " "), false)
+		c.Interface.Event(e)
+	case ShellStart:
+		title := e.Command
+		if e.script {
+			// only the first line of scripts
+			title, _, _ = strings.Cut(strings.TrimSpace(title), "\n")
+		}
+		if e.Prefix != "" {
+			title = e.Prefix + " $ " + title
+		}
+		c.startGroup(title, true)
+		c.Interface.Event(e)
+	case CommandEnd:
+		c.Interface.Event(e)
+		c.endGroup(false)
+	case ShellEnd:
+		c.Interface.Event(e)
+		c.endGroup(true)
+	default:
+		c.Interface.Event(e)
+	}
+}
+
+func (c CI) startGroup(title string, shell bool) {
+	if Quiet {
+		return
+	}
+
+	g := c.groups
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if shell {
+		g.shells++
+		if g.shells > 1 {
+			// another process is running, so neither is grouped
+			if g.shell != "" {
+				c.end(g, g.shell)
+				g.shell = ""
+			}
+			return
+		}
+	}
+
+	g.count++
+	name := fmt.Sprintf("sindr_%d", g.count)
+	switch c.system {
+	case CIGitHub:
+		// GitHub doesn't support nested groups, so the outer group is ended instead
+		if g.visible {
+			c.write("::endgroup::")
+		}
+		c.write("::group::" + title)
+		g.visible = true
+	case CIGitLab:
+		c.write(fmt.Sprintf("\x1b[0Ksection_start:%d:%s[collapsed=true]\r\x1b[0K%s", time.Now().Unix(), name, title))
+	}
+	g.open = append(g.open, name)
+	if shell {
+		g.shell = name
+	}
+}
+
+// endGroup ends the group of the process that exited, if it was grouped, or the innermost group of a command.
+func (c CI) endGroup(shell bool) {
+	if Quiet {
+		return
+	}
+
+	g := c.groups
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if shell {
+		g.shells--
+		if g.shells == 0 && g.shell != "" {
+			c.end(g, g.shell)
+			g.shell = ""
+		}
+		return
+	}
+
+	for i := len(g.open) - 1; i >= 0; i-- {
+		if g.open[i] != g.shell {
+			c.end(g, g.open[i])
+			return
+		}
+	}
+}
+
+func (c CI) endGroups() {
+	g := c.groups
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for len(g.open) > 0 {
+		c.end(g, g.open[len(g.open)-1])
+	}
+	g.shell = ""
+}
+
+// end ends the open group with the given name.
+func (c CI) end(g *ciGroups, name string) {
+	i := slices.Index(g.open, name)
+	if i == -1 {
+		return
+	}
+
+	innermost := i == len(g.open)-1
+	g.open = slices.Delete(g.open, i, i+1)
+	switch c.system {
+	case CIGitHub:
+		// the logs of any outer group that was ended when this one started are no longer grouped
+		if innermost && g.visible {
+			c.write("::endgroup::")
+			g.visible = false
+		}
+	case CIGitLab:
+		c.write(fmt.Sprintf("\x1b[0Ksection_end:%d:%s\r\x1b[0K", time.Now().Unix(), name))
+	}
+}
+
+// annotate writes an error annotation, pointing to the innermost position in a Starlark file where it happened.
+func (c CI) annotate(message string, err error) {
+	stack := c.stack()
+	var serr *starlark.EvalError
+	if errors.As(err, &serr) {
+		stack = serr.CallStack
+	}
+
+	props := ""
+	for i := len(stack) - 1; i >= 0; i-- {
+		pos := stack[i].Pos
+		if pos.IsValid() && pos.Filename() != "<builtin>" {
+			props = fmt.Sprintf(" file=%s,line=%d,col=%d", escapeProperty(pos.Filename()), pos.Line, pos.Col)
+			break
+		}
+	}
+
+	c.write(fmt.Sprintf("::error%s::%s", props, escapeData(message+": "+err.Error())))
+}
+
+// stack returns the Starlark stack of the wrapped logger, if it has one.
+func (c CI) stack() starlark.CallStack {
+	switch l := c.Interface.(type) {
+	case Logger:
+		return l.stack
+	case JSON:
+		return l.stack
+	default:
+		return nil
+	}
+}
+
+func (c CI) write(line string) {
+	_, _ = fmt.Fprintln(Writer, Redact(line))
+}
+
+// escapeData escapes the characters GitHub treats specially in the message of a workflow command.
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeProperty escapes the characters GitHub treats specially in the properties of a workflow command.
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ",", "%2C", ":", "%3A").Replace(s)
+}
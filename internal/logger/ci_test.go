@@ -0,0 +1,148 @@
+package logger_test
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.starlark.net/starlark"
+
+	"github.com/mbark/sindr/internal/logger"
+	"github.com/mbark/sindr/internal/sindrtest"
+)
+
+func TestCI(t *testing.T) {
+	script := `
+def test_action(ctx):
+    shell('echo built', prefix='build')
+    shell('echo tested')
+
+cli(name="TestCI")
+command(name="test", action=test_action)
+`
+
+	t.Run("groups commands and processes on GitHub", func(t *testing.T) {
+		var buf bytes.Buffer
+		sindrtest.Test(t, script,
+			sindrtest.WithLogger(logger.Logger{}),
+			sindrtest.WithWriter(&buf),
+			sindrtest.WithArgs("--ci", "github", "test"))
+
+		var markers []string
+		for _, line := range strings.Split(buf.String(), "\n") {
+			if strings.HasPrefix(line, "::") {
+				markers = append(markers, line)
+			}
+		}
+		assert.Equal(t, []string{
+			"::group::test",
+			"::endgroup::",
+			"::group::build $ echo built",
+			"::endgroup::",
+			"::group::echo tested",
+			"::endgroup::",
+		}, markers)
+		assert.Contains(t, buf.String(), "::group::build $ echo built\n"+logger.RenderPrefix("build"))
+	})
+
+	t.Run("masks secrets on GitHub", func(t *testing.T) {
+		var buf bytes.Buffer
+		sindrtest.Test(t, `
+def test_action(ctx):
+    shell('echo {{.token}}', token=secret('hunter22'))
+
+cli(name="TestCI")
+command(name="test", action=test_action)
+`,
+			sindrtest.WithLogger(logger.Logger{}),
+			sindrtest.WithWriter(&buf),
+			sindrtest.WithArgs("--ci", "github", "test"))
+
+		assert.Contains(t, buf.String(), "::add-mask::hunter22\n")
+		assert.Equal(t, 1, strings.Count(buf.String(), "hunter22"))
+	})
+
+	t.Run("uses collapsible sections on GitLab", func(t *testing.T) {
+		var buf bytes.Buffer
+		sindrtest.Test(t, script,
+			sindrtest.WithLogger(logger.Logger{}),
+			sindrtest.WithWriter(&buf),
+			sindrtest.WithArgs("--ci", "gitlab", "test"))
+
+		out := buf.String()
+		assert.Regexp(t, `\x1b\[0Ksection_start:\d+:sindr_1\[collapsed=true\]\r\x1b\[0Ktest\n`, out)
+		assert.Regexp(t, `section_start:\d+:sindr_2\[collapsed=true\]\r\x1b\[0Kbuild \$ echo built\n`, out)
+		assert.Regexp(t, `section_end:\d+:sindr_2\r`, out)
+		assert.Regexp(t, `section_end:\d+:sindr_1\r`, out)
+		assert.Less(t, strings.Index(out, ":sindr_2\r"), strings.Index(out, ":sindr_1\r"),
+			"the sections are nested")
+	})
+
+	t.Run("doesn't group processes running at the same time", func(t *testing.T) {
+		concurrent := `
+def test_action(ctx):
+    p = pool()
+    p.run(lambda: shell('sleep 0.2 && echo first'))
+    p.run(lambda: shell('sleep 0.2 && echo second'))
+    p.wait()
+    shell('echo after')
+
+cli(name="TestCI")
+command(name="test", action=test_action)
+`
+
+		writer := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, concurrent,
+			sindrtest.WithLogger(logger.Logger{}),
+			sindrtest.WithWriter(writer),
+			sindrtest.WithArgs("--ci", "github", "test"))
+
+		var markers []string
+		for _, line := range strings.Split(strings.Join(writer.Writes, ""), "\n") {
+			if strings.HasPrefix(line, "::") {
+				markers = append(markers, line)
+			}
+		}
+		require.Len(t, markers, 6)
+		assert.Equal(t, []string{"::group::test", "::endgroup::"}, markers[:2])
+		assert.Regexp(t, `^::group::sleep 0.2 && echo (first|second)$`, markers[2])
+		assert.Equal(t, []string{"::endgroup::", "::group::echo after", "::endgroup::"}, markers[3:])
+
+		writer = new(sindrtest.CollectWriter)
+		sindrtest.Test(t, concurrent,
+			sindrtest.WithLogger(logger.Logger{}),
+			sindrtest.WithWriter(writer),
+			sindrtest.WithArgs("--ci", "gitlab", "test"))
+		out := strings.Join(writer.Writes, "")
+
+		starts := regexp.MustCompile(`section_start:\d+:(sindr_\d+)\[`).FindAllStringSubmatch(out, -1)
+		ends := regexp.MustCompile(`section_end:\d+:(sindr_\d+)\r`).FindAllStringSubmatch(out, -1)
+		require.Len(t, starts, 3)
+		require.Len(t, ends, 3)
+		var started, ended []string
+		for i := range starts {
+			started = append(started, starts[i][1])
+			ended = append(ended, ends[i][1])
+		}
+		assert.Equal(t, []string{"sindr_1", "sindr_2", "sindr_3"}, started)
+		assert.Equal(t, []string{"sindr_2", "sindr_3", "sindr_1"}, ended)
+	})
+
+	t.Run("annotates errors with where they happened", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger.Writer = &buf
+		t.Cleanup(func() { logger.Writer = os.Stderr })
+
+		thread := &starlark.Thread{Name: "test"}
+		_, err := starlark.ExecFile(thread, "sindr.star", "\n\ndef f():\n    fail('broken: 100%')\n\nf()\n", nil)
+		require.Error(t, err)
+
+		ci := logger.NewCI(logger.Logger{}, logger.CIGitHub)
+		ci.LogErr("error running sindr", err)
+		assert.Contains(t, buf.String(), "::error file=sindr.star,line=4,col=9::error running sindr: fail: broken: 100%25\n")
+	})
+}
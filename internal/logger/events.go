@@ -0,0 +1,226 @@
+package logger
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"go.starlark.net/starlark"
+)
+
+// Event is something that happened while running a command, like a shell command finishing. Events are rendered as
+// text by Logger and as JSON objects by JSON.
+type Event interface {
+	// EventType is the type of the event, like "shell_start".
+	EventType() string
+}
+
+// Duration is a time.Duration that is marshalled to JSON as a number of milliseconds.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(float64(d) / float64(time.Millisecond))
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var ms float64
+	if err := json.Unmarshal(b, &ms); err != nil {
+		return err
+	}
+
+	*d = Duration(ms * float64(time.Millisecond))
+	return nil
+}
+
+// Arg is a flag or argument given to a command.
+type Arg struct {
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases,omitempty"`
+	Value   any      `json:"value"`
+	// Display is how the value is shown in text logs.
+	Display string `json:"-"`
+}
+
+// CommandStart is logged when a command is started, with the flags and arguments it was given.
+type CommandStart struct {
+	Command string `json:"command"`
+	// Path is the names of the command and the commands it's a sub command of, like ["deploy", "staging"].
+	Path       []string `json:"path"`
+	Flags      []Arg    `json:"flags"`
+	Args       []Arg    `json:"args"`
+	Positional []string `json:"positional"`
+}
+
+// CommandEnd is logged when a command has finished, with the error it failed with if any.
+type CommandEnd struct {
+	Command  string   `json:"command"`
+	Duration Duration `json:"duration_ms"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// ShellStart is logged when a process is started.
+type ShellStart struct {
+	Prefix  string `json:"prefix,omitempty"`
+	Command string `json:"command"`
+
+	// script is set if the command is a script, which is only shown in verbose text logs.
+	script bool
+	style  PrefixStyle
+}
+
+// ShellOutput is a line written by a process to stdout or stderr.
+type ShellOutput struct {
+	Prefix string `json:"prefix,omitempty"`
+	Stream string `json:"stream"`
+	Line   string `json:"line"`
+
+	// time is when the line was written, shown in text logs if set.
+	time  time.Time
+	style PrefixStyle
+}
+
+// PrefixStyle is how the prefix of a process is shown in text logs, for the output of several processes shown together
+// to be told apart.
+type PrefixStyle struct {
+	// Color is the colour of the prefix, picked from the prefix if nil.
+	Color lipgloss.TerminalColor
+	// Width is the width the prefix is padded to, to align the output of the processes.
+	Width int
+	// Timestamps shows the time each line was written.
+	Timestamps bool
+}
+
+// NewScriptStart creates the event for a script being started, which is only shown in verbose text logs.
+func NewScriptStart(prefix, script string) ShellStart {
+	return ShellStart{Prefix: prefix, Command: script, script: true}
+}
+
+// NewStyledShellStart creates the event for a process being started, with its prefix shown in the style in text logs.
+func NewStyledShellStart(prefix, command string, style PrefixStyle) ShellStart {
+	return ShellStart{Prefix: prefix, Command: command, style: style}
+}
+
+// NewStyledShellOutput creates the event for a line written by a process, with its prefix shown in the style in text
+// logs.
+func NewStyledShellOutput(prefix, stream, line string, style PrefixStyle) ShellOutput {
+	e := ShellOutput{Prefix: prefix, Stream: stream, Line: line, style: style}
+	if style.Timestamps {
+		e.time = time.Now()
+	}
+	return e
+}
+
+// ShellEnd is logged when a process has exited.
+type ShellEnd struct {
+	Prefix   string   `json:"prefix,omitempty"`
+	Command  string   `json:"command"`
+	ExitCode int      `json:"exit_code"`
+	Success  bool     `json:"success"`
+	Attempts int      `json:"attempts"`
+	Duration Duration `json:"duration_ms"`
+	// Stderr is everything the process wrote to stderr, which is already logged line by line as ShellOutput.
+	Stderr string `json:"-"`
+}
+
+// CacheCheck is logged when the cache is checked for a version, which is a hit if the version is unchanged.
+type CacheCheck struct {
+	Name    string  `json:"name"`
+	Current *string `json:"current"`
+	Version string  `json:"version"`
+	Hit     bool    `json:"hit"`
+}
+
+// TaskSpawned is logged when a task is started in the background, with start(), pool.run() or service().
+type TaskSpawned struct {
+	// ID identifies the task, to match it with when it's finished.
+	ID   int64  `json:"id"`
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// TaskFinished is logged when a task started in the background has finished, with the error it failed with if any.
+type TaskFinished struct {
+	ID       int64    `json:"id"`
+	Kind     string   `json:"kind"`
+	Name     string   `json:"name"`
+	Success  bool     `json:"success"`
+	Error    string   `json:"error,omitempty"`
+	Duration Duration `json:"duration_ms"`
+	// ProcessFailed is set if the task failed by returning the result of a process that failed, which is already
+	// logged as a failed ShellEnd.
+	ProcessFailed bool `json:"process_failed,omitempty"`
+}
+
+// Error is logged when something fails, with the Starlark stack of where it failed if there is one.
+type Error struct {
+	Message string `json:"message"`
+	Error   string `json:"error"`
+	Stack   string `json:"stack,omitempty"`
+}
+
+// NewError creates the event for err, with the Starlark stack if err is a *starlark.EvalError.
+func NewError(message string, err error) Error {
+	e := Error{Message: message, Error: err.Error()}
+
+	var serr *starlark.EvalError
+	if errors.As(err, &serr) {
+		e.Stack = serr.CallStack.String()
+	}
+	return e
+}
+
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+const (
+	TaskStart   = "start"
+	TaskPool    = "pool"
+	TaskService = "service"
+)
+
+func (CommandStart) EventType() string { return "command_start" }
+func (CommandEnd) EventType() string   { return "command_end" }
+func (ShellStart) EventType() string   { return "shell_start" }
+func (ShellOutput) EventType() string  { return "shell_output" }
+func (ShellEnd) EventType() string     { return "shell_end" }
+func (CacheCheck) EventType() string   { return "cache_check" }
+func (TaskSpawned) EventType() string  { return "task_spawned" }
+func (TaskFinished) EventType() string { return "task_finished" }
+func (Error) EventType() string        { return "error" }
+
+var (
+	// Handlers are called with every event as it happens, whether or not it's logged.
+	Handlers   []func(Event)
+	handlersMu sync.Mutex
+)
+
+// Notify calls the Handlers with the event, with any secrets in it redacted. Events can happen concurrently, but the
+// handlers are only called with one event at a time.
+func Notify(e Event) {
+	if len(Handlers) == 0 {
+		return
+	}
+
+	e = RedactEvent(e)
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	for _, h := range Handlers {
+		h(e)
+	}
+}
+
+// LogEvent calls the Handlers with the event and logs it with l.
+func LogEvent(l Interface, e Event) {
+	Notify(e)
+	l.Event(e)
+}
+
+// LogError calls the Handlers with an Error event for err and logs it with l.
+func LogError(l Interface, message string, err error) {
+	Notify(NewError(message, err))
+	l.LogErr(message, err)
+}
@@ -0,0 +1,96 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/x/ansi"
+	"go.starlark.net/starlark"
+)
+
+// jsonMu makes sure that JSON objects written concurrently aren't interleaved.
+var jsonMu sync.Mutex
+
+var _ Interface = JSON{}
+
+// JSON logs one JSON object per line for each event and log message, for logs to be processed by other programs.
+type JSON struct {
+	stack starlark.CallStack
+}
+
+func (j JSON) WithStack(stack starlark.CallStack) Interface {
+	j.stack = stack
+	return j
+}
+
+func (j JSON) Print(message string) {
+	Logger{}.Print(message)
+}
+
+func (j JSON) Emit(message string) {
+	Logger{}.Emit(message)
+}
+
+func (j JSON) Log(messages ...string) {
+	if Quiet {
+		return
+	}
+
+	j.write("log", map[string]any{"message": ansi.Strip(strings.Join(messages, " "))})
+}
+
+func (j JSON) LogErr(message string, err error) {
+	// errors are logged even when quiet
+	j.writeEvent(NewError(message, err))
+}
+
+func (j JSON) LogVerbose(messages ...string) {
+	if !DoLogVerbose || Quiet {
+		return
+	}
+
+	j.write("log", map[string]any{"message": ansi.Strip(strings.Join(messages, " ")), "verbose": true})
+}
+
+func (j JSON) Event(e Event) {
+	if _, verbose := Render(e); Quiet || (verbose && !DoLogVerbose) {
+		return
+	}
+
+	j.writeEvent(e)
+}
+
+func (j JSON) writeEvent(e Event) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		j.LogErr("marshal event", err)
+		return
+	}
+	fields := make(map[string]any)
+	if err := json.Unmarshal(b, &fields); err != nil {
+		j.LogErr("marshal event", err)
+		return
+	}
+
+	j.write(e.EventType(), fields)
+}
+
+func (j JSON) write(typ string, fields map[string]any) {
+	fields["type"] = typ
+	fields["time"] = time.Now().Format(time.RFC3339Nano)
+	if len(j.stack) > 0 {
+		fields["pos"] = j.stack[0].Pos.String()
+	}
+
+	b, err := json.Marshal(fields)
+	if err != nil {
+		b = fmt.Appendf(nil, `{"type":"error","message":"marshal log","error":%q}`, err.Error())
+	}
+
+	jsonMu.Lock()
+	defer jsonMu.Unlock()
+	_, _ = fmt.Fprintln(Writer, Redact(string(b)))
+}
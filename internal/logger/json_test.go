@@ -0,0 +1,142 @@
+package logger_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mbark/sindr/internal/logger"
+	"github.com/mbark/sindr/internal/sindrtest"
+)
+
+func TestJSON(t *testing.T) {
+	t.Run("logs one object per event", func(t *testing.T) {
+		var buf bytes.Buffer
+		sindrtest.Test(t, `
+def test_action(ctx):
+    shell('echo out; echo err >&2; exit 3', prefix='build')
+    c = cache()
+    c.diff(name='version', version='1')
+    print('done')
+
+cli(name="TestJSON")
+command(name="test", action=test_action, flags=[string_flag("env", default="dev")])
+`, sindrtest.WithLogger(logger.JSON{}), sindrtest.WithWriter(&buf))
+
+		events := make(map[string][]map[string]any)
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var event map[string]any
+			require.NoError(t, json.Unmarshal([]byte(line), &event), line)
+			assert.NotEmpty(t, event["time"])
+			typ := event["type"].(string)
+			events[typ] = append(events[typ], event)
+		}
+
+		require.Len(t, events["command_start"], 1)
+		assert.Equal(t, "test", events["command_start"][0]["command"])
+		assert.Equal(t, []any{map[string]any{"name": "env", "value": "dev"}}, events["command_start"][0]["flags"])
+
+		require.Len(t, events["shell_start"], 1)
+		assert.Equal(t, "build", events["shell_start"][0]["prefix"])
+		assert.Equal(t, "echo out; echo err >&2; exit 3", events["shell_start"][0]["command"])
+		assert.Contains(t, events["shell_start"][0]["pos"], "test.star:3")
+
+		outputs := make(map[string]string)
+		for _, e := range events["shell_output"] {
+			outputs[e["stream"].(string)] = e["line"].(string)
+		}
+		assert.Equal(t, map[string]string{"stdout": "out", "stderr": "err"}, outputs)
+
+		require.Len(t, events["shell_end"], 1)
+		assert.InDelta(t, 3, events["shell_end"][0]["exit_code"], 0)
+		assert.Equal(t, false, events["shell_end"][0]["success"])
+		assert.Contains(t, events["shell_end"][0], "duration_ms")
+
+		require.Len(t, events["cache_check"], 1)
+		assert.Equal(t, false, events["cache_check"][0]["hit"])
+
+		var logs []string
+		for _, e := range events["log"] {
+			if e["verbose"] != true {
+				logs = append(logs, e["message"].(string))
+			}
+		}
+		assert.Equal(t, []string{"done"}, logs)
+
+		require.Len(t, events["command_end"], 1)
+		assert.NotContains(t, events["command_end"][0], "error")
+	})
+
+	t.Run("only logs the templated command verbosely", func(t *testing.T) {
+		var buf bytes.Buffer
+		sindrtest.Test(t, `
+def test_action(ctx):
+    shell('echo {{.word}}', word='templated')
+
+cli(name="TestJSON")
+command(name="test", action=test_action)
+`, sindrtest.WithLogger(logger.JSON{}), sindrtest.WithWriter(&buf))
+
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var event map[string]any
+			require.NoError(t, json.Unmarshal([]byte(line), &event), line)
+			switch {
+			case event["type"] == "shell_start":
+				assert.Equal(t, "echo {{.word}}", event["command"])
+			case event["type"] == "log" && event["verbose"] != true:
+				assert.NotContains(t, event["message"], "echo templated")
+			}
+		}
+	})
+
+	t.Run("only logs what happened for processes, not how it's shown in text logs", func(t *testing.T) {
+		var buf bytes.Buffer
+		sindrtest.Test(t, `
+def test_action(ctx):
+    processes({'web': 'echo started', 'worker': 'sleep 60'}, timestamps=True)
+
+cli(name="TestJSON")
+command(name="test", action=test_action)
+`, sindrtest.WithLogger(logger.JSON{}), sindrtest.WithWriter(&buf))
+
+		var shellEvents int
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var event map[string]any
+			require.NoError(t, json.Unmarshal([]byte(line), &event), line)
+			delete(event, "time")
+			delete(event, "pos")
+
+			var keys []string
+			for k := range event {
+				keys = append(keys, k)
+			}
+			switch event["type"] {
+			case "shell_start":
+				shellEvents++
+				assert.ElementsMatch(t, []string{"type", "prefix", "command"}, keys)
+			case "shell_output":
+				shellEvents++
+				assert.ElementsMatch(t, []string{"type", "prefix", "stream", "line"}, keys)
+			}
+		}
+		assert.Equal(t, 3, shellEvents)
+	})
+
+	t.Run("logs errors", func(t *testing.T) {
+		var buf bytes.Buffer
+		writer := logger.Writer
+		logger.Writer = &buf
+		t.Cleanup(func() { logger.Writer = writer })
+		logger.JSON{}.LogErr("failed", assert.AnError)
+
+		var event map[string]any
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &event))
+		assert.Equal(t, "error", event["type"])
+		assert.Equal(t, "failed", event["message"])
+		assert.Equal(t, assert.AnError.Error(), event["error"])
+	})
+}
@@ -16,7 +16,12 @@ var (
 	Default         Interface = Logger{}
 	DoLogVerbose    bool
 	WithLineNumbers bool
-	Writer          io.Writer = os.Stdout
+	// Quiet suppresses all logs except errors, leaving only the data written to Output.
+	Quiet bool
+	// Writer is where logs are written, kept separate from Output so that the output of sindr can be piped.
+	Writer io.Writer = os.Stderr
+	// Output is where data is written, like the output of emit() and shell completions.
+	Output io.Writer = os.Stdout
 
 	stackStyle        = lipgloss.NewStyle().Foreground(lipgloss.ANSIColor(ansi.Black)).Faint(true)
 	errorHeaderStyle  = lipgloss.NewStyle().Foreground(lipgloss.ANSIColor(ansi.Red)).Bold(true)
@@ -27,9 +32,11 @@ type Interface interface {
 	WithStack(stack starlark.CallStack) Interface
 
 	Print(message string)
+	Emit(message string)
 	Log(messages ...string)
 	LogErr(message string, err error)
 	LogVerbose(messages ...string)
+	Event(e Event)
 }
 
 var _ Interface = Logger{}
@@ -46,6 +53,10 @@ func Print(message string) {
 	Default.Print(message)
 }
 
+func Emit(message string) {
+	Default.Emit(message)
+}
+
 func Log(messages ...string) {
 	Default.Log(messages...)
 }
@@ -67,29 +78,42 @@ func (l Logger) WithStack(stack starlark.CallStack) Interface {
 	return l
 }
 
+// Print writes the message as-is to Output.
 func (l Logger) Print(message string) {
-	_, _ = fmt.Fprint(Writer, message)
+	_, _ = fmt.Fprint(Output, message)
+}
+
+// Emit writes the message as a line of data to Output.
+func (l Logger) Emit(message string) {
+	_, _ = fmt.Fprintln(Output, message)
 }
 
 func (l Logger) Log(messages ...string) {
+	if Quiet {
+		return
+	}
+
+	l.log(messages...)
+}
+
+func (l Logger) log(messages ...string) {
+	message := Redact(strings.Join(messages, " "))
 	if len(l.stack) > 0 && WithLineNumbers {
-		_, _ = fmt.Fprintf(Writer, "%s %s\n",
-			stackStyle.Render(l.stack[0].Pos.String()),
-			strings.Join(messages, " "),
-		)
+		_, _ = fmt.Fprintf(Writer, "%s %s\n", stackStyle.Render(l.stack[0].Pos.String()), message)
 		return
 	}
 
-	_, _ = fmt.Fprintf(Writer, "%s\n", strings.Join(messages, " "))
+	_, _ = fmt.Fprintf(Writer, "%s\n", message)
 }
 
 func (l Logger) LogErr(message string, err error) {
-	l.Log(errorHeaderStyle.Render(message))
-	l.Log(errorMessageStyle.Render(err.Error()))
+	// errors are logged even when quiet
+	l.log(errorHeaderStyle.Render(message))
+	l.log(errorMessageStyle.Render(err.Error()))
 
 	var serr *starlark.EvalError
 	if errors.As(err, &serr) {
-		l.Log(errorMessageStyle.Render(serr.CallStack.String()))
+		l.log(errorMessageStyle.Render(serr.CallStack.String()))
 	}
 }
 
@@ -100,3 +124,14 @@ func (l Logger) LogVerbose(messages ...string) {
 
 	l.Log(messages...)
 }
+
+func (l Logger) Event(e Event) {
+	lines, verbose := Render(e)
+	for _, line := range lines {
+		if verbose {
+			l.LogVerbose(line)
+		} else {
+			l.Log(line)
+		}
+	}
+}
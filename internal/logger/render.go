@@ -0,0 +1,125 @@
+package logger
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+var (
+	actionHeaderStyle = lipgloss.NewStyle().Foreground(lipgloss.ANSIColor(ansi.Magenta)).Bold(true)
+	argHeaderStyle    = lipgloss.NewStyle().Padding(0, 2).Foreground(lipgloss.ANSIColor(ansi.Cyan))
+	argStyle          = lipgloss.NewStyle().Faint(true).Padding(0, 4)
+	commandStyle      = lipgloss.NewStyle().Foreground(lipgloss.ANSIColor(ansi.Blue)).Padding(0, 2)
+	stdoutStyle       = lipgloss.NewStyle().Faint(true).Padding(0, 2)
+	stderrStyle       = lipgloss.NewStyle().Foreground(lipgloss.ANSIColor(ansi.Red)).Padding(0, 2)
+	timestampStyle    = lipgloss.NewStyle().Faint(true)
+	cachePrefixStyle  = lipgloss.NewStyle().Faint(true)
+	cacheNameStyle    = lipgloss.NewStyle().Bold(true)
+
+	// prefixColors are the colours prefixes are given. Prefixes shown together are given them in order, see
+	// PrefixColor, and others are given one by a hash of the prefix so that the same prefix always gets the same colour.
+	prefixColors = []lipgloss.ANSIColor{
+		lipgloss.ANSIColor(ansi.Cyan),
+		lipgloss.ANSIColor(ansi.Magenta),
+		lipgloss.ANSIColor(ansi.Green),
+		lipgloss.ANSIColor(ansi.Yellow),
+		lipgloss.ANSIColor(ansi.Blue),
+		lipgloss.ANSIColor(ansi.BrightCyan),
+		lipgloss.ANSIColor(ansi.BrightMagenta),
+		lipgloss.ANSIColor(ansi.BrightGreen),
+		lipgloss.ANSIColor(ansi.BrightYellow),
+		lipgloss.ANSIColor(ansi.BrightBlue),
+	}
+)
+
+// PrefixColor returns the colour of the i:th of several prefixes shown together, so that they get distinct colours.
+func PrefixColor(i int) lipgloss.TerminalColor {
+	return prefixColors[i%len(prefixColors)]
+}
+
+// RenderPrefix renders the prefix of a log line in a colour that is stable for the prefix. Any padding around the
+// prefix is ignored when picking the colour, to allow aligning prefixes of different lengths.
+func RenderPrefix(prefix string) string {
+	return RenderPrefixColor(prefix, nil)
+}
+
+// RenderPrefixColor renders the prefix of a log line in the colour, or in the one RenderPrefix picks if it's nil.
+func RenderPrefixColor(prefix string, color lipgloss.TerminalColor) string {
+	if color == nil {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(strings.TrimSpace(prefix)))
+		color = prefixColors[h.Sum32()%uint32(len(prefixColors))]
+	}
+
+	return lipgloss.NewStyle().Foreground(color).Render(prefix)
+}
+
+// Render renders an event as lines of text, and whether they should only be shown when logging verbosely.
+func Render(e Event) ([]string, bool) {
+	switch e := e.(type) {
+	case CommandStart:
+		lines := []string{actionHeaderStyle.Render(e.Command)}
+		renderArgs := func(header string, args []Arg) {
+			if len(args) == 0 {
+				return
+			}
+			lines = append(lines, argHeaderStyle.Render(header))
+			for _, a := range args {
+				names := strings.Join(append([]string{a.Name}, a.Aliases...), ",")
+				lines = append(lines, argStyle.Render(fmt.Sprintf("%s: %s", names, a.Display)))
+			}
+		}
+		renderArgs("Flags", e.Flags)
+		renderArgs("Named arguments", e.Args)
+		if len(e.Positional) > 0 {
+			lines = append(lines, argHeaderStyle.Render("Positional arguments"))
+			for i, a := range e.Positional {
+				lines = append(lines, argStyle.Render(fmt.Sprintf("%d: %s", i, a)))
+			}
+		}
+		return lines, false
+
+	case ShellStart:
+		return []string{withPrefix(e.Prefix, e.style.Color, commandStyle.Render(e.Command))}, e.script
+
+	case ShellOutput:
+		style := stdoutStyle
+		if e.Stream == StreamStderr {
+			style = stderrStyle
+		}
+		line := e.Line
+		if !e.time.IsZero() {
+			line = timestampStyle.Render(e.time.Format(time.TimeOnly)) + " " + line
+		}
+		prefix := fmt.Sprintf("%-*s", e.style.Width, e.Prefix)
+		return []string{withPrefix(prefix, e.style.Color, style.Render(line))}, false
+
+	case CacheCheck:
+		current := "current not set"
+		if e.Current != nil {
+			current = cachePrefixStyle.Render("current=") + cacheNameStyle.Render(*e.Current)
+		}
+		return []string{strings.Join([]string{
+			cachePrefixStyle.Render("cache:"),
+			cacheNameStyle.Render(e.Name),
+			current,
+			cachePrefixStyle.Render("version=") + cacheNameStyle.Render(e.Version),
+		}, " ")}, true
+
+	default:
+		// the remaining events are only shown in JSON logs
+		return nil, false
+	}
+}
+
+func withPrefix(prefix string, color lipgloss.TerminalColor, line string) string {
+	if strings.TrimSpace(prefix) == "" {
+		return line
+	}
+	return RenderPrefixColor(prefix, color) + " " + line
+}
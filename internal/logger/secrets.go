@@ -0,0 +1,140 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Redacted is what secret values are replaced with in logs.
+const Redacted = "***"
+
+var (
+	secretsMu sync.RWMutex
+	secrets   []string
+	redactor  *strings.Replacer
+)
+
+// AddSecret registers a value that is replaced with Redacted in everything logged from now on. When running in GitHub
+// Actions the value is also masked by the runner, to hide it in the output of processes not logged by sindr.
+func AddSecret(value string) {
+	if value == "" {
+		return
+	}
+
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	if slices.Contains(secrets, value) {
+		return
+	}
+
+	if c, ok := Default.(CI); ok && c.system == CIGitHub {
+		_, _ = fmt.Fprintln(Writer, "::add-mask::"+escapeData(value))
+	}
+
+	secrets = append(secrets, value)
+	// longer secrets first, so that a secret containing another is redacted as a whole
+	slices.SortStableFunc(secrets, func(a, b string) int { return len(b) - len(a) })
+
+	var pairs []string
+	for _, s := range secrets {
+		pairs = append(pairs, s, Redacted)
+		// secrets in JSON logs are escaped, so they need to be redacted in their escaped form too
+		if escaped := jsonEscape(s); escaped != s {
+			pairs = append(pairs, escaped, Redacted)
+		}
+	}
+	redactor = strings.NewReplacer(pairs...)
+}
+
+// ResetSecrets forgets all secrets that have been registered.
+func ResetSecrets() {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	secrets = nil
+	redactor = nil
+}
+
+// Redact replaces every secret in s with Redacted.
+func Redact(s string) string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	if redactor == nil {
+		return s
+	}
+	return redactor.Replace(s)
+}
+
+// RedactEvent returns a copy of the event with every secret in its strings replaced with Redacted.
+func RedactEvent(e Event) Event {
+	secretsMu.RLock()
+	none := redactor == nil
+	secretsMu.RUnlock()
+	if none {
+		return e
+	}
+
+	v := reflect.New(reflect.TypeOf(e)).Elem()
+	v.Set(reflect.ValueOf(e))
+	redactValue(v)
+
+	redacted, ok := v.Interface().(Event)
+	if !ok {
+		return e
+	}
+	return redacted
+}
+
+func redactValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		if v.CanSet() {
+			v.SetString(Redact(v.String()))
+		}
+	case reflect.Struct:
+		for i := range v.NumField() {
+			if v.Type().Field(i).IsExported() {
+				redactValue(v.Field(i))
+			}
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			return
+		}
+		// slices are copied to not change those of the original event
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(c, v)
+		for i := range c.Len() {
+			redactValue(c.Index(i))
+		}
+		v.Set(c)
+	case reflect.Pointer:
+		if v.IsNil() {
+			return
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(v.Elem())
+		redactValue(c.Elem())
+		v.Set(c)
+	case reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		c := reflect.New(v.Elem().Type()).Elem()
+		c.Set(v.Elem())
+		redactValue(c)
+		v.Set(c)
+	default:
+	}
+}
+
+func jsonEscape(s string) string {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return s
+	}
+	return string(b[1 : len(b)-1])
+}
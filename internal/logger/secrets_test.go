@@ -0,0 +1,59 @@
+package logger_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mbark/sindr/internal/logger"
+)
+
+func TestRedact(t *testing.T) {
+	t.Cleanup(logger.ResetSecrets)
+
+	t.Run("redacts the longest secret first", func(t *testing.T) {
+		logger.ResetSecrets()
+		logger.AddSecret("token")
+		logger.AddSecret("token-with-suffix")
+		logger.AddSecret("")
+
+		assert.Equal(t, "a *** and ***", logger.Redact("a token-with-suffix and token"))
+	})
+
+	t.Run("redacts events without changing the original", func(t *testing.T) {
+		logger.ResetSecrets()
+		logger.AddSecret("hunter22")
+
+		current := "v-hunter22"
+		e := logger.CommandStart{
+			Command:    "deploy",
+			Flags:      []logger.Arg{{Name: "token", Value: "hunter22", Display: "'hunter22'"}},
+			Positional: []string{"hunter22"},
+		}
+		assert.Equal(t, logger.CommandStart{
+			Command:    "deploy",
+			Flags:      []logger.Arg{{Name: "token", Value: "***", Display: "'***'"}},
+			Positional: []string{"***"},
+		}, logger.RedactEvent(e))
+		assert.Equal(t, "hunter22", e.Flags[0].Value)
+		assert.Equal(t, "hunter22", e.Positional[0])
+
+		check := logger.RedactEvent(logger.CacheCheck{Name: "version", Current: &current}).(logger.CacheCheck)
+		assert.Equal(t, "v-***", *check.Current)
+		assert.Equal(t, "v-hunter22", current)
+	})
+
+	t.Run("redacts escaped secrets in JSON logs", func(t *testing.T) {
+		var buf bytes.Buffer
+		writer := logger.Writer
+		logger.Writer = &buf
+		t.Cleanup(func() { logger.Writer = writer })
+
+		logger.ResetSecrets()
+		logger.AddSecret(`quote"d`)
+		logger.JSON{}.Log(`the secret is quote"d`)
+
+		assert.Contains(t, buf.String(), `"message":"the secret is ***"`)
+	})
+}
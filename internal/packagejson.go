@@ -6,12 +6,13 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/urfave/cli/v3"
 	"go.starlark.net/starlark"
 
-	"github.com/mbark/sindr/internal/logger"
+	"github.com/mbark/sindr/internal/policy"
 )
 
 func SindrLoadPackageJson(
@@ -33,6 +34,9 @@ func SindrLoadPackageJson(
 		bin = "npm"
 	}
 
+	if err := policy.CheckPath(thread, "load_package_json", file, false); err != nil {
+		return nil, err
+	}
 	bs, err := os.ReadFile(file)
 	if err != nil {
 		return nil, err
@@ -48,8 +52,11 @@ func SindrLoadPackageJson(
 	if err != nil {
 		return nil, err
 	}
+	if abs, err := filepath.Abs(file); err == nil {
+		sindrCLI.Inputs = append(sindrCLI.Inputs, abs)
+	}
 
-	logger := logger.WithStack(thread.CallStack())
+	logger := GetLogger(thread)
 	logger.LogVerbose(
 		lipgloss.NewStyle().
 			Faint(true).
@@ -0,0 +1,327 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.starlark.net/starlark"
+
+	"github.com/mbark/sindr/internal/logger"
+	"github.com/mbark/sindr/internal/trace"
+)
+
+// SindrPipe connects the output of each stage to the input of the next one, like `a | b | c` in a shell. A stage is
+// either a list of arguments to run as a process, a string to run with the shell or a function that is called for
+// each line of output from the previous stage.
+func SindrPipe(
+	thread *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	var prefix string
+	var noOutput, pipefail bool
+	if err := starlark.UnpackArgs("pipe", nil, kwargs,
+		"prefix?", &prefix,
+		"no_output?", &noOutput,
+		"pipefail?", &pipefail,
+	); err != nil {
+		return nil, err
+	}
+
+	if args.Len() == 0 {
+		return nil, errors.New("pipe() requires at least 1 stage")
+	}
+
+	stages := make([]*pipeStage, args.Len())
+	for i, arg := range args {
+		stage, err := parsePipeStage(thread, arg)
+		if err != nil {
+			return nil, fmt.Errorf("stage %d: %w", i, err)
+		}
+		stages[i] = stage
+	}
+	if stages[0].filter != nil {
+		return nil, errors.New("stage 0: the first stage must be a process")
+	}
+
+	descriptions := mapList(stages, func(s *pipeStage) string { return s.description })
+	pipeline := strings.Join(descriptions, " | ")
+
+	logger := GetLogger(thread)
+	logStart(logger, prefix, pipeline)
+	span := trace.Begin(thread, "pipe", pipeline)
+	if prefix != "" {
+		logger.LogVerbose(renderPrefix(prefix), commandStyle.Render("$ "+pipeline))
+	} else {
+		logger.LogVerbose(commandStyle.Render("$ " + pipeline))
+	}
+
+	p := &pipeRun{
+		thread:   thread,
+		logger:   logger,
+		prefix:   prefix,
+		noOutput: noOutput,
+	}
+	res, err := p.run(stages, pipefail)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Command = pipeline
+	span.End(res.traceArgs())
+	logEnd(logger, prefix, &res.ShellResult)
+	return res, nil
+}
+
+type pipeStage struct {
+	description string
+	argv        []string
+	filter      starlark.Callable
+}
+
+func parsePipeStage(thread *starlark.Thread, v starlark.Value) (*pipeStage, error) {
+	switch v := v.(type) {
+	case *starlark.List:
+		argv, err := parseArgv(v)
+		if err != nil {
+			return nil, err
+		}
+		bin, err := exec.LookPath(argv[0])
+		if err != nil {
+			return nil, err
+		}
+		return &pipeStage{description: quoteArgv(argv), argv: append([]string{bin}, argv[1:]...)}, nil
+
+	case starlark.String:
+		shell, err := resolveShell(thread, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &pipeStage{description: string(v), argv: append(slices.Clone(shell), string(v))}, nil
+
+	case starlark.Callable:
+		return &pipeStage{description: "<" + v.Name() + ">", filter: v}, nil
+
+	default:
+		return nil, fmt.Errorf("expected list, string or callable, got %s", v.Type())
+	}
+}
+
+type pipeRun struct {
+	thread   *starlark.Thread
+	logger   logger.Interface
+	prefix   string
+	noOutput bool
+
+	mu     sync.Mutex
+	stderr strings.Builder
+}
+
+func (p *pipeRun) run(stages []*pipeStage, pipefail bool) (*PipeResult, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := time.Now()
+	exitCodes := make([]int, len(stages))
+	errs := make([]error, len(stages))
+
+	var wg sync.WaitGroup
+	// like $! in a shell, the pid of a pipe is that of its last process
+	var pid int
+	var in *io.PipeReader
+	var out *io.PipeReader
+	// stop kills the stages that have already started and waits for them, when a later one can't be started
+	stop := func() {
+		cancel()
+		if in != nil {
+			_ = in.Close()
+		}
+		wg.Wait()
+	}
+	for i, stage := range stages {
+		pr, pw := io.Pipe()
+		stdin := in
+
+		if stage.filter != nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = p.runFilter(i, stage.filter, stdin, pw)
+				if errs[i] != nil {
+					exitCodes[i] = 1
+				}
+				_ = pw.Close()
+				_ = stdin.CloseWithError(errs[i])
+			}()
+		} else {
+			cmd := exec.CommandContext(ctx, stage.argv[0], stage.argv[1:]...) // #nosec G204
+			if stdin != nil {
+				cmd.Stdin = stdin
+			}
+			cmd.Stdout = pw
+			stderr, err := cmd.StderrPipe()
+			if err != nil {
+				stop()
+				return nil, fmt.Errorf("stderr pipe: %w", err)
+			}
+			if err := cmd.Start(); err != nil {
+				stop()
+				return nil, fmt.Errorf("stage %d: cmd start: %w", i, err)
+			}
+			pid = cmd.Process.Pid
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				p.scanStderr(stderr)
+				err := cmd.Wait()
+				exitCodes[i] = cmd.ProcessState.ExitCode()
+				_, exited := errorAs[*exec.ExitError](err)
+				if err != nil && !exited && !isClosedPipe(i, len(stages), err) {
+					errs[i] = err
+				}
+
+				_ = pw.Close()
+				// let the previous stage know that nothing more will be read
+				if stdin != nil {
+					_ = stdin.Close()
+				}
+			}()
+		}
+
+		in, out = pr, pr
+	}
+
+	var stdout strings.Builder
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !p.noOutput {
+			stdout.WriteString(line + "\n")
+		}
+		logOutput(p.logger, p.prefix, logger.StreamStdout, line)
+	}
+	_ = out.Close()
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	exitCode := exitCodes[len(exitCodes)-1]
+	if pipefail {
+		for _, c := range exitCodes {
+			if c != 0 {
+				exitCode = c
+			}
+		}
+	}
+
+	return &PipeResult{
+		ShellResult: ShellResult{
+			Stdout:   strings.TrimSpace(stdout.String()),
+			Stderr:   strings.TrimSpace(p.stderr.String()),
+			ExitCode: exitCode,
+			Success:  exitCode == 0,
+			Attempts: 1,
+			Duration: time.Since(started),
+			Pid:      pid,
+		},
+		ExitCodes: exitCodes,
+	}, nil
+}
+
+// isClosedPipe returns whether err is from stage writing to the next stage after it has exited, which a shell ignores
+// as well, e.g. for `seq 1 10000 | head -n 1`.
+func isClosedPipe(stage, stages int, err error) bool {
+	return stage < stages-1 && (errors.Is(err, io.ErrClosedPipe) || errors.Is(err, syscall.EPIPE))
+}
+
+func (p *pipeRun) scanStderr(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !p.noOutput {
+			p.mu.Lock()
+			p.stderr.WriteString(line + "\n")
+			p.mu.Unlock()
+		}
+		logOutput(p.logger, p.prefix, logger.StreamStderr, line)
+	}
+}
+
+// runFilter calls filter for each line read from r. The line is dropped if None or False is returned, kept if True is
+// returned and replaced if a string is returned.
+func (p *pipeRun) runFilter(
+	stage int,
+	filter starlark.Callable,
+	r io.Reader,
+	w io.Writer,
+) error {
+	thread := newChildThread(p.thread, "pipe")
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		res, err := starlark.Call(thread, filter, starlark.Tuple{starlark.String(line)}, nil)
+		if err != nil {
+			return fmt.Errorf("stage %d: %w", stage, err)
+		}
+
+		switch res := res.(type) {
+		case starlark.NoneType:
+			continue
+		case starlark.Bool:
+			if !res {
+				continue
+			}
+		case starlark.String:
+			line = string(res)
+		default:
+			return fmt.Errorf("stage %d: expected %s to return string, bool or None, got %s",
+				stage, filter.Name(), res.Type())
+		}
+
+		if _, err := io.WriteString(w, line+"\n"); err != nil {
+			// the next stage has stopped reading
+			return nil
+		}
+	}
+
+	return scanner.Err()
+}
+
+var (
+	_ starlark.Value    = (*PipeResult)(nil)
+	_ starlark.HasAttrs = (*PipeResult)(nil)
+)
+
+// PipeResult is the result of a pipe(), which is a ShellResult that also holds the exit code of every stage.
+type PipeResult struct {
+	ShellResult
+	ExitCodes []int
+}
+
+func (p PipeResult) Attr(name string) (starlark.Value, error) {
+	if name == "exit_codes" {
+		return toList(p.ExitCodes, func(i int) starlark.Value { return starlark.MakeInt(i) }), nil
+	}
+	return p.ShellResult.Attr(name)
+}
+
+func (p PipeResult) AttrNames() []string {
+	return append(p.ShellResult.AttrNames(), "exit_codes")
+}
+
+func (p PipeResult) Type() string {
+	return "pipe_result"
+}
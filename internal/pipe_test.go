@@ -0,0 +1,133 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/mbark/sindr/internal/sindrtest"
+)
+
+func TestPipe(t *testing.T) {
+	t.Run("pipes output between processes", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = pipe(['printf', 'a\\nb\\nc\\n'], ['grep', '-v', 'b'], ['tr', 'a-z', 'A-Z'])
+    assert_equals('A\nC', result.stdout)
+    assert_equals([0, 0, 0], result.exit_codes)
+    assert_true(result.success)
+
+cli(name="TestPipe")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("runs string stages with the shell", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = pipe('echo hello && echo world', ['wc', '-l'])
+    assert_equals('2', result.stdout.strip())
+
+cli(name="TestPipe")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("reports the exit code of each stage", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = pipe('echo out; exit 3', ['cat'])
+    assert_equals([3, 0], result.exit_codes)
+    assert_equals(0, result.exit_code)
+    assert_true(result.success)
+
+cli(name="TestPipe")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("pipefail uses the last failing exit code", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = pipe('exit 3', 'cat; exit 4', ['cat'], pipefail=True)
+    assert_equals([3, 4, 0], result.exit_codes)
+    assert_equals(4, result.exit_code)
+    assert_false(result.success)
+
+cli(name="TestPipe")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("filters lines with a function", func(t *testing.T) {
+		sindrtest.Test(t, `
+def upper_or_drop(line):
+    if line == 'drop':
+        return None
+    if line == 'keep':
+        return True
+    return line.upper()
+
+def test_action(ctx):
+    result = pipe(['printf', 'a\\ndrop\\nkeep\\nb\\n'], upper_or_drop, lambda line: 'x' + line)
+    assert_equals('xA\nxkeep\nxB', result.stdout)
+    assert_equals([0, 0, 0], result.exit_codes)
+
+cli(name="TestPipe")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("collects stderr from all stages", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = pipe('echo first >&2', 'cat; echo second >&2')
+    assert_true('first' in result.stderr)
+    assert_true('second' in result.stderr)
+
+cli(name="TestPipe")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("stops early stages when a later one exits", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = pipe(['yes'], ['head', '-n', '2'])
+    assert_equals('y\ny', result.stdout)
+
+cli(name="TestPipe")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("doesn't fail when a later stage exits before reading everything", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    for _ in range(20):
+        result = pipe(['seq', '1', '10000'], ['head', '-n', '1'])
+        assert_equals('1', result.stdout)
+
+cli(name="TestPipe")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("fails when a filter fails", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    pipe(['echo', 'a'], lambda line: 1)
+
+cli(name="TestPipe")
+command(name="test", action=test_action)
+`, sindrtest.ShouldFail())
+	})
+
+	t.Run("fails when the first stage is a function", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    pipe(lambda line: line, ['cat'])
+
+cli(name="TestPipe")
+command(name="test", action=test_action)
+`, sindrtest.ShouldFail())
+	})
+}
@@ -0,0 +1,173 @@
+// Package policy restricts what Starlark files can do, by denying groups of builtins and limiting the files they can
+// access to a set of roots.
+package policy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.starlark.net/starlark"
+)
+
+// The groups of builtins a policy can allow or deny.
+const (
+	// Process is for builtins starting processes.
+	Process = "process"
+	// Network is for builtins making network requests, like the readiness checks of services.
+	Network = "network"
+	// FSWrite is for builtins writing files, like shell(..., stdout_file=...).
+	FSWrite = "fs_write"
+	// Env is for builtins changing the environment variables of sindr, like dotenv().
+	Env = "env"
+)
+
+// Groups are all the groups of builtins.
+var Groups = []string{Process, Network, FSWrite, Env}
+
+// GroupBuiltins are the builtins that belong to a group as a whole. Other builtins only use a group with some of their
+// arguments, and check it themselves.
+var GroupBuiltins = map[string][]string{
+	Process: {"shell", "exec", "run", "pipe", "service", "processes", "load_package_json"},
+	Env:     {"dotenv"},
+}
+
+// Default is the policy builtins are checked against, which is nil when everything is allowed.
+var Default *Policy
+
+// Policy restricts the builtins that can be used, and the files that can be accessed.
+type Policy struct {
+	// Allow are the groups of builtins that can be used, all groups if empty.
+	Allow []string `mapstructure:"allow"`
+	// Deny are the groups of builtins that can't be used, which takes precedence over Allow.
+	Deny []string `mapstructure:"deny"`
+	// Roots are the directories files can be accessed in, anywhere if empty. They are relative to the directory of the
+	// Starlark file, and environment variables in them are expanded, with $TMPDIR always being the temp directory.
+	Roots []string `mapstructure:"roots"`
+
+	roots []string
+}
+
+// IsZero returns whether the policy allows everything.
+func (p Policy) IsZero() bool {
+	return len(p.Allow) == 0 && len(p.Deny) == 0 && len(p.Roots) == 0
+}
+
+// New validates the policy, resolving its roots relative to dir.
+func New(p Policy, dir string) (*Policy, error) {
+	for _, g := range append(slices.Clone(p.Allow), p.Deny...) {
+		if !slices.Contains(Groups, g) {
+			return nil, fmt.Errorf("policy: unknown group %q, expected one of %s", g, strings.Join(Groups, ", "))
+		}
+	}
+
+	for _, root := range p.Roots {
+		root = os.Expand(root, func(name string) string {
+			if name == "TMPDIR" {
+				return os.TempDir()
+			}
+			return os.Getenv(name)
+		})
+		if !filepath.IsAbs(root) {
+			root = filepath.Join(dir, root)
+		}
+		p.roots = append(p.roots, resolve(root))
+	}
+	return &p, nil
+}
+
+// Allowed returns whether the builtins in the group can be used.
+func (p *Policy) Allowed(group string) bool {
+	if p == nil {
+		return true
+	}
+	if slices.Contains(p.Deny, group) {
+		return false
+	}
+	return len(p.Allow) == 0 || slices.Contains(p.Allow, group)
+}
+
+// Check returns an error if the builtin called from thread uses a group that isn't allowed by the Default policy.
+func Check(thread *starlark.Thread, builtin, group string) error {
+	if Default.Allowed(group) {
+		return nil
+	}
+	return violation(thread, builtin, fmt.Sprintf("%s is denied by the policy", group))
+}
+
+// CheckPath returns an error if the builtin called from thread accesses a file outside the roots of the Default
+// policy, or writes one without the fs_write group being allowed.
+func CheckPath(thread *starlark.Thread, builtin, path string, write bool) error {
+	if write {
+		if err := Check(thread, builtin, FSWrite); err != nil {
+			return err
+		}
+	}
+	if Default == nil || len(Default.roots) == 0 {
+		return nil
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	abs = resolve(abs)
+	for _, root := range Default.roots {
+		if within(root, abs) {
+			return nil
+		}
+	}
+	return violation(thread, builtin, fmt.Sprintf("%s is outside of the roots allowed by the policy", path))
+}
+
+// Wrap replaces the builtins of the groups that aren't allowed by the Default policy with ones failing.
+func Wrap(predeclared starlark.StringDict) {
+	for group, names := range GroupBuiltins {
+		if Default.Allowed(group) {
+			continue
+		}
+
+		for _, name := range names {
+			if _, ok := predeclared[name]; !ok {
+				continue
+			}
+			predeclared[name] = starlark.NewBuiltin(name, func(
+				thread *starlark.Thread,
+				fn *starlark.Builtin,
+				args starlark.Tuple,
+				kwargs []starlark.Tuple,
+			) (starlark.Value, error) {
+				return nil, Check(thread, name, group)
+			})
+		}
+	}
+}
+
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// violation creates the error for a builtin not allowed by the policy, with the position it was called from.
+func violation(thread *starlark.Thread, builtin, reason string) error {
+	// the innermost frame is the builtin itself
+	if thread != nil && thread.CallStackDepth() > 1 {
+		return fmt.Errorf("%s: not allowed at %s: %s", builtin, thread.CallFrame(1).Pos, reason)
+	}
+	return fmt.Errorf("%s: not allowed: %s", builtin, reason)
+}
+
+// resolve resolves the symlinks in path, or in its closest parent that exists for files that are yet to be created.
+func resolve(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path
+	}
+	return filepath.Join(resolve(parent), filepath.Base(path))
+}
@@ -0,0 +1,105 @@
+package policy_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mbark/sindr"
+	"github.com/mbark/sindr/internal/sindrtest"
+)
+
+func TestPolicy(t *testing.T) {
+	t.Run("denies builtins in denied groups", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    shell('echo hi')
+
+cli(name="TestPolicy")
+command(name="test", action=test_action)
+`, sindrtest.WithPolicy(sindr.Policy{Deny: []string{sindr.PolicyProcess}}),
+			sindrtest.ShouldFailWith("shell: not allowed at test.star:3:10: process is denied by the policy"))
+	})
+
+	t.Run("only allows the groups allowed", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    shell('echo hi')
+    shell('echo hi', stdout_file='out.txt')
+
+cli(name="TestPolicy")
+command(name="test", action=test_action)
+`, sindrtest.WithPolicy(sindr.Policy{Allow: []string{sindr.PolicyProcess}}),
+			sindrtest.ShouldFailWith("shell: not allowed at test.star:4:10: fs_write is denied by the policy"))
+	})
+
+	t.Run("denies network requests", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    service('db', 'sleep 1', ready={'port': 1})
+
+cli(name="TestPolicy")
+command(name="test", action=test_action)
+`, sindrtest.WithPolicy(sindr.Policy{Deny: []string{sindr.PolicyNetwork}}),
+			sindrtest.ShouldFailWith("service: not allowed at test.star:3:12: network is denied by the policy"))
+	})
+
+	t.Run("restricts files to the roots", func(t *testing.T) {
+		outside := filepath.Join(t.TempDir(), "Procfile")
+		require.NoError(t, os.WriteFile(outside, []byte("web: echo hi\n"), 0o600))
+
+		script := `
+def test_action(ctx):
+    shell('echo "web: echo hi" > Procfile')
+    load_procfile('Procfile')
+    load_procfile('` + outside + `')
+
+cli(name="TestPolicy")
+command(name="test", action=test_action)
+`
+		sindrtest.Test(t, script, sindrtest.WithPolicy(sindr.Policy{Roots: []string{"."}}),
+			sindrtest.ShouldFailWith("load_procfile: not allowed at test.star:5:18: "+outside+" is outside of the roots"))
+		sindrtest.Test(t, script, sindrtest.WithPolicy(sindr.Policy{Roots: []string{".", "$TMPDIR"}}))
+	})
+
+	t.Run("is read from the user config", func(t *testing.T) {
+		configDir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(configDir, "sindr.yaml"), []byte("policy:\n  deny: [env]\n"),
+			0o600))
+
+		sindrtest.Test(t, `
+def test_action(ctx):
+    dotenv()
+
+cli(name="TestPolicy")
+command(name="test", action=test_action)
+`, sindrtest.WithEnv("XDG_CONFIG_HOME", configDir),
+			sindrtest.ShouldFailWith("dotenv: not allowed at test.star:3:11: env is denied by the policy"))
+	})
+
+	t.Run("is read from the environment", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    dotenv()
+
+cli(name="TestPolicy")
+command(name="test", action=test_action)
+`, sindrtest.WithEnv("XDG_CONFIG_HOME", t.TempDir()), sindrtest.WithEnv("SINDR_POLICY_DENY", "env"),
+			sindrtest.ShouldFailWith("dotenv: not allowed at test.star:3:11: env is denied by the policy"))
+	})
+
+	t.Run("can't be set by the project config", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "sindr.yaml"), []byte("policy:\n  deny: []\n"), 0o600))
+
+		sindrtest.Test(t, `cli(name="TestPolicy")`, sindrtest.WithDirectory(dir),
+			sindrtest.ShouldFailWith("can't set policy, it's only read from the user config"))
+	})
+
+	t.Run("rejects unknown groups", func(t *testing.T) {
+		sindrtest.Test(t, `cli(name="TestPolicy")`, sindrtest.WithPolicy(sindr.Policy{Deny: []string{"files"}}),
+			sindrtest.ShouldFailWith(`unknown group "files"`))
+	})
+}
@@ -0,0 +1,291 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"go.starlark.net/starlark"
+
+	"github.com/mbark/sindr/internal/logger"
+	"github.com/mbark/sindr/internal/policy"
+	"github.com/mbark/sindr/internal/trace"
+)
+
+// SindrRun runs a process from a list of arguments, without going through a shell. This means that the arguments are
+// passed as-is to the process, so values containing spaces or quotes are never reinterpreted.
+func SindrRun(
+	thread *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	var argvList *starlark.List
+	opts := newProcessOptions()
+	if err := starlark.UnpackArgs("run", args, kwargs, append([]any{
+		"argv", &argvList,
+	}, opts.unpackPairs()...)...); err != nil {
+		return nil, err
+	}
+	if err := opts.checkPolicy(thread, "run"); err != nil {
+		return nil, err
+	}
+	prefix := opts.prefix
+
+	argv, err := parseArgv(argvList)
+	if err != nil {
+		return nil, fmt.Errorf("argv: %w", err)
+	}
+
+	bin, err := exec.LookPath(argv[0])
+	if err != nil {
+		return nil, fmt.Errorf("run: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger := GetLogger(thread)
+	logStart(logger, prefix, quoteArgv(argv))
+	span := trace.Begin(thread, "run", quoteArgv(argv))
+
+	newCmd := func() *exec.Cmd {
+		return exec.CommandContext(ctx, bin, argv[1:]...) // #nosec G204
+	}
+	if prefix != "" {
+		logger.LogVerbose(renderPrefix(prefix), commandStyle.Render("$ "+quoteArgv(argv)))
+	} else {
+		logger.LogVerbose(commandStyle.Render("$ " + quoteArgv(argv)))
+	}
+
+	res, err := opts.start(logger, newCmd)
+	if err != nil {
+		return nil, fmt.Errorf("start cmd failed: %w", err)
+	}
+
+	res.Command = quoteArgv(argv)
+	span.End(res.traceArgs())
+	logEnd(logger, prefix, res)
+	return res, nil
+}
+
+// processKwargs are the keyword arguments accepted by all builtins that start a process.
+var processKwargs = []string{
+	"prefix", "no_output", "stdin", "stdin_file", "stdout_file", "stderr_file", "tee",
+	"retries", "retry_delay", "backoff", "retry_on", "environ",
+}
+
+// processOptions holds the options shared by all builtins that start a process, see processKwargs.
+type processOptions struct {
+	prefix     string
+	noOutput   bool
+	stdin      starlark.Value
+	stdinFile  string
+	stdoutFile string
+	stderrFile string
+	tee        bool
+	retries    int
+	retryDelay starlark.Value
+	backoff    starlark.Value
+	retryOn    *starlark.List
+	environ    *starlark.Dict
+}
+
+// newProcessOptions returns the options of a process before the kwargs are unpacked, with the defaults set.
+func newProcessOptions() processOptions {
+	return processOptions{tee: true}
+}
+
+// unpackPairs returns the pairs to pass to starlark.UnpackArgs to unpack the options.
+func (o *processOptions) unpackPairs() []any {
+	return []any{
+		"prefix?", &o.prefix,
+		"no_output?", &o.noOutput,
+		"stdin?", &o.stdin,
+		"stdin_file?", &o.stdinFile,
+		"stdout_file?", &o.stdoutFile,
+		"stderr_file?", &o.stderrFile,
+		"tee?", &o.tee,
+		"retries?", &o.retries,
+		"retry_delay?", &o.retryDelay,
+		"backoff?", &o.backoff,
+		"retry_on?", &o.retryOn,
+		"environ?", &o.environ,
+	}
+}
+
+// checkPolicy checks that the files given are allowed to be accessed by the policy.
+func (o *processOptions) checkPolicy(thread *starlark.Thread, builtin string) error {
+	if o.stdinFile != "" {
+		if err := policy.CheckPath(thread, builtin, o.stdinFile, false); err != nil {
+			return err
+		}
+	}
+	for _, file := range []string{o.stdoutFile, o.stderrFile} {
+		if file == "" {
+			continue
+		}
+		if err := policy.CheckPath(thread, builtin, file, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// start runs the command created by newCmd with its input and output set up according to the options, retrying it if
+// it fails and retries are configured. A command can only be started once, so newCmd is called for every attempt.
+func (o *processOptions) start(logger logger.Interface, newCmd func() *exec.Cmd) (*ShellResult, error) {
+	policy, err := newRetryPolicy(o.retries, o.retryDelay, o.backoff)
+	if err != nil {
+		return nil, err
+	}
+	retryOn, err := fromList(o.retryOn, castInt)
+	if err != nil {
+		return nil, fmt.Errorf("retry_on: %w", err)
+	}
+	started := time.Now()
+	for attempt := 1; ; attempt++ {
+		cmd := newCmd()
+		if err := o.setEnv(cmd); err != nil {
+			return nil, err
+		}
+
+		res, err := o.startOnce(logger, cmd)
+		if err != nil {
+			return nil, err
+		}
+
+		res.Attempts = attempt
+		res.Duration = time.Since(started)
+		if res.Success || attempt > policy.retries ||
+			(len(retryOn) > 0 && !slices.Contains(retryOn, res.ExitCode)) {
+			return res, nil
+		}
+
+		policy.wait(logger, o.prefix, attempt, fmt.Sprintf("exited with %d", res.ExitCode))
+	}
+}
+
+// setEnv adds the environment variables given with environ to those the command inherits.
+func (o *processOptions) setEnv(cmd *exec.Cmd) error {
+	if o.environ == nil {
+		return nil
+	}
+
+	env := cmd.Environ()
+	for k, v := range o.environ.Entries() {
+		key, err := cast[starlark.String](k)
+		if err != nil {
+			return fmt.Errorf("environ: invalid key: %w", err)
+		}
+		value, err := secretOrString(v)
+		if err != nil {
+			return fmt.Errorf("environ: invalid value for %s: %w", string(key), err)
+		}
+		env = append(env, string(key)+"="+value)
+	}
+	cmd.Env = env
+	return nil
+}
+
+func (o *processOptions) startOnce(logger logger.Interface, cmd *exec.Cmd) (res *ShellResult, err error) {
+	closeFile := func(f *os.File) {
+		if cerr := f.Close(); cerr != nil {
+			err = errors.Join(err, cerr)
+		}
+	}
+
+	switch {
+	case o.stdin != nil && o.stdinFile != "":
+		return nil, errors.New("only one of stdin and stdin_file can be given")
+	case o.stdinFile != "":
+		f, err := os.Open(o.stdinFile)
+		if err != nil {
+			return nil, fmt.Errorf("stdin_file: %w", err)
+		}
+		defer closeFile(f)
+		cmd.Stdin = f
+	case o.stdin != nil:
+		switch v := o.stdin.(type) {
+		case starlark.String:
+			cmd.Stdin = strings.NewReader(string(v))
+		case starlark.Bytes:
+			cmd.Stdin = strings.NewReader(string(v))
+		case Secret:
+			cmd.Stdin = strings.NewReader(string(v))
+		default:
+			return nil, fmt.Errorf("stdin: expected string, bytes or secret, got %s", o.stdin.Type())
+		}
+	}
+
+	var stdout, stderr io.Writer
+	if o.stdoutFile != "" {
+		f, err := os.Create(o.stdoutFile)
+		if err != nil {
+			return nil, fmt.Errorf("stdout_file: %w", err)
+		}
+		defer closeFile(f)
+		stdout = f
+	}
+	if o.stderrFile != "" {
+		f, err := os.Create(o.stderrFile)
+		if err != nil {
+			return nil, fmt.Errorf("stderr_file: %w", err)
+		}
+		defer closeFile(f)
+		stderr = f
+	}
+
+	return StartShellCmd(logger, cmd, o.prefix, o.noOutput, WithOutputFiles(stdout, stderr, o.tee))
+}
+
+// parseArgv converts a list of strings and ints to the arguments of a process.
+func parseArgv(l *starlark.List) ([]string, error) {
+	argv, err := fromList(l, func(value starlark.Value) (string, error) {
+		switch v := value.(type) {
+		case starlark.String:
+			return string(v), nil
+		case starlark.Int:
+			return v.String(), nil
+		default:
+			return "", fmt.Errorf("expected string or int, got %s", value.Type())
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(argv) == 0 {
+		return nil, errors.New("must contain at least the executable")
+	}
+
+	return argv, nil
+}
+
+// quoteArgv formats the arguments as they would have to be written in a shell, used to show the command being run.
+func quoteArgv(argv []string) string {
+	quoted := make([]string, len(argv))
+	for i, a := range argv {
+		quoted[i] = shellQuote(a)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if !strings.ContainsFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+			strings.ContainsRune("-_./=:,+@%", r))
+	}) {
+		return s
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
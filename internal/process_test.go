@@ -0,0 +1,76 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/mbark/sindr/internal/sindrtest"
+)
+
+func TestRun(t *testing.T) {
+	t.Run("runs a process from a list of arguments", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = run(['echo', 'hello', 'world'])
+    assert_equals('hello world', result.stdout)
+    assert_true(result.success)
+
+cli(name="TestRun")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("passes arguments without reinterpreting them", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = run(['printf', '%s|', ctx.flags.pattern, '$HOME', '; echo injected'])
+    assert_equals('it\'s "quoted" *|$HOME|; echo injected|', result.stdout)
+
+cli(name="TestRun")
+command(name="test", action=test_action, flags=[string_flag("pattern")])
+`, sindrtest.WithArgs("test", "--pattern", `it's "quoted" *`))
+	})
+
+	t.Run("converts ints to arguments", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = run(['echo', 1, 2])
+    assert_equals('1 2', result.stdout)
+
+cli(name="TestRun")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("captures stderr and exit code", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = run(['sh', '-c', 'echo oops >&2; exit 3'], prefix='RUN')
+    assert_equals('oops', result.stderr)
+    assert_equals(3, result.exit_code)
+    assert_false(result.success)
+
+cli(name="TestRun")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("fails when the executable can't be found", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    run(['sindr-does-not-exist'])
+
+cli(name="TestRun")
+command(name="test", action=test_action)
+`, sindrtest.ShouldFail())
+	})
+
+	t.Run("fails on an empty list", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    run([])
+
+cli(name="TestRun")
+command(name="test", action=test_action)
+`, sindrtest.ShouldFail())
+	})
+}
@@ -0,0 +1,178 @@
+package internal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.starlark.net/starlark"
+
+	"github.com/mbark/sindr/internal/logger"
+	"github.com/mbark/sindr/internal/policy"
+)
+
+// SindrProcesses runs several processes concurrently, like foreman or overmind, given as a dict of names to commands.
+// When any of the processes exits, the others are stopped as well.
+func SindrProcesses(
+	thread *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	var procs *starlark.Dict
+	var timestamps bool
+	if err := starlark.UnpackArgs("processes", args, kwargs,
+		"procs", &procs,
+		"timestamps?", &timestamps,
+	); err != nil {
+		return nil, err
+	}
+	if procs.Len() == 0 {
+		return nil, errors.New("processes: requires at least 1 process")
+	}
+
+	sindrCLI, err := getSindrCLI(thread)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, procs.Len())
+	argvs := make([][]string, procs.Len())
+	width := 0
+	for i, item := range procs.Items() {
+		name, err := castString(item[0])
+		if err != nil {
+			return nil, fmt.Errorf("processes: name: %w", err)
+		}
+		argv, err := commandArgv(thread, item[1])
+		if err != nil {
+			return nil, fmt.Errorf("processes: %s: %w", name, err)
+		}
+
+		names[i] = name
+		argvs[i] = argv
+		width = max(width, len(name))
+	}
+
+	l := GetLogger(thread)
+	pad := func(name string) string { return fmt.Sprintf("%-*s", width, name) }
+
+	svcs := make([]*Service, len(names))
+	exited := make(chan int, len(names))
+	for i, name := range names {
+		// the processes are given colours in order, so that they are all distinct
+		style := logger.PrefixStyle{Color: logger.PrefixColor(i), Width: width, Timestamps: timestamps}
+		logger.LogEvent(l, logger.NewStyledShellStart(name, quoteArgv(argvs[i]), style))
+
+		svc, err := startService(name, argvs[i], nil, nil, func(stream, line string) {
+			logger.LogEvent(l, logger.NewStyledShellOutput(name, stream, line, style))
+		})
+		if err != nil {
+			for _, started := range svcs[:i] {
+				started.Stop()
+			}
+			return nil, err
+		}
+		sindrCLI.addService(svc)
+		svcs[i] = svc
+
+		go func() {
+			<-svc.exited
+			exited <- i
+		}()
+	}
+
+	first := <-exited
+
+	stopped := make([]bool, len(svcs))
+	for i, svc := range svcs {
+		select {
+		case <-svc.exited:
+		default:
+			stopped[i] = true
+			svc.Stop()
+		}
+	}
+
+	results := starlark.NewDict(len(svcs))
+	for i, svc := range svcs {
+		res := svc.result()
+		status := fmt.Sprintf("exited with %d", res.ExitCode)
+		if stopped[i] {
+			status = "stopped"
+		}
+		l.Log(logger.RenderPrefixColor(pad(names[i]), logger.PrefixColor(i)), interpreterStyle.Render(status))
+
+		if err := results.SetKey(starlark.String(names[i]), res); err != nil {
+			return nil, err
+		}
+	}
+
+	if res := svcs[first].result(); !res.Success {
+		return nil, fmt.Errorf("processes: %s exited with %d", names[first], res.ExitCode)
+	}
+
+	return results, nil
+}
+
+// SindrLoadProcfile reads a Procfile into a dict of names to commands, which can be passed to processes().
+func SindrLoadProcfile(
+	thread *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	file := "Procfile"
+	if err := starlark.UnpackArgs("load_procfile", args, kwargs, "file?", &file); err != nil {
+		return nil, err
+	}
+
+	if err := policy.CheckPath(thread, "load_procfile", file, false); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("load_procfile: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	procs := starlark.NewDict(0)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		name, command, ok := strings.Cut(text, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("load_procfile: %s:%d: expected 'name: command'", file, line)
+		}
+		if err := procs.SetKey(
+			starlark.String(strings.TrimSpace(name)),
+			starlark.String(strings.TrimSpace(command)),
+		); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("load_procfile: %w", err)
+	}
+
+	return procs, nil
+}
+
+// result returns the result of a service that has exited.
+func (s *Service) result() *ShellResult {
+	state := s.cmd.ProcessState
+	return &ShellResult{
+		ExitCode: state.ExitCode(),
+		Success:  state.Success(),
+		Attempts: 1,
+		Duration: s.exitedAt.Sub(s.started),
+		Command:  quoteArgv(s.cmd.Args),
+		Pid:      s.cmd.Process.Pid,
+	}
+}
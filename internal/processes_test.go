@@ -0,0 +1,107 @@
+package internal_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mbark/sindr/internal/logger"
+	"github.com/mbark/sindr/internal/sindrtest"
+)
+
+func TestProcesses(t *testing.T) {
+	t.Run("stops the other processes when one exits", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    results = processes({
+        'web': 'sleep 60',
+        'worker': ['sleep', '60'],
+        'migrate': 'echo done',
+    }, timestamps=True)
+    assert_equals(['web', 'worker', 'migrate'], results.keys())
+    assert_true(results['migrate'].success)
+    assert_false(results['web'].success)
+    assert_false(results['worker'].success)
+
+cli(name="TestProcesses")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("fails if a process exits with an error", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    processes({'web': 'sleep 60', 'worker': 'exit 2'})
+
+cli(name="TestProcesses")
+command(name="test", action=test_action)
+`, sindrtest.ShouldFail())
+	})
+
+	t.Run("gives the processes distinct colours", func(t *testing.T) {
+		profile := lipgloss.ColorProfile()
+		lipgloss.SetColorProfile(termenv.ANSI)
+		t.Cleanup(func() { lipgloss.SetColorProfile(profile) })
+
+		writer := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, `
+def test_action(ctx):
+    processes({'web': 'echo started', 'frontend': 'sleep 60'})
+
+cli(name="TestProcesses")
+command(name="test", action=test_action)
+`, sindrtest.WithLogger(logger.Logger{}), sindrtest.WithWriter(writer))
+
+		web := logger.RenderPrefixColor("web     ", logger.PrefixColor(0))
+		frontend := logger.RenderPrefixColor("frontend", logger.PrefixColor(1))
+		require.Equal(t, strings.Replace(logger.RenderPrefix("web"), "web", "frontend", 1),
+			logger.RenderPrefix("frontend"), "the colours picked from the prefixes collide")
+		assert.NotEqual(t, web, frontend)
+		out := strings.Join(writer.Writes, "")
+		assert.Contains(t, out, web+" ")
+		assert.Contains(t, out, frontend+" ")
+	})
+
+	t.Run("loads processes from a Procfile", func(t *testing.T) {
+		procfile := filepath.Join(t.TempDir(), "Procfile")
+		err := os.WriteFile(procfile, []byte(`
+# the web server
+web: bundle exec rails server -p $PORT
+worker:   bundle exec sidekiq
+`), 0o600)
+		require.NoError(t, err)
+
+		sindrtest.Test(t, fmt.Sprintf(`
+def test_action(ctx):
+    procs = load_procfile('%s')
+    assert_equals({
+        'web': 'bundle exec rails server -p $PORT',
+        'worker': 'bundle exec sidekiq',
+    }, procs)
+
+cli(name="TestProcesses")
+command(name="test", action=test_action)
+`, procfile))
+	})
+
+	t.Run("fails on an invalid Procfile", func(t *testing.T) {
+		procfile := filepath.Join(t.TempDir(), "Procfile")
+		err := os.WriteFile(procfile, []byte("web\n"), 0o600)
+		require.NoError(t, err)
+
+		sindrtest.Test(t, fmt.Sprintf(`
+def test_action(ctx):
+    load_procfile('%s')
+
+cli(name="TestProcesses")
+command(name="test", action=test_action)
+`, procfile), sindrtest.ShouldFail())
+	})
+}
@@ -0,0 +1,194 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/charmbracelet/x/term"
+
+	"github.com/mbark/sindr/internal/logger"
+)
+
+var (
+	spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+	spinnerStyle  = lipgloss.NewStyle().Foreground(lipgloss.ANSIColor(ansi.Blue))
+	successStyle  = lipgloss.NewStyle().Foreground(lipgloss.ANSIColor(ansi.Green))
+	failedStyle   = lipgloss.NewStyle().Foreground(lipgloss.ANSIColor(ansi.Red))
+	progressStyle = lipgloss.NewStyle().Padding(0, 2)
+	elapsedStyle  = lipgloss.NewStyle().Faint(true)
+
+	progressInterval = 100 * time.Millisecond
+)
+
+// Progress shows the tasks that are running, spawned with start(), pool() or service(). On a terminal the tasks are
+// shown below the logs with a spinner that is redrawn as they run, otherwise a line is logged when each task finishes.
+type Progress struct {
+	mu    sync.Mutex
+	out   io.Writer
+	live  bool
+	tasks []*ProgressTask
+	// drawn is the number of lines drawn below the logs, which are cleared before writing logs
+	drawn int
+	frame int
+	stop  chan struct{}
+}
+
+// NewProgress creates a progress display writing to out, returning nil if it isn't enabled. The display is only live
+// when both stdout and out are terminals and verbose logging is disabled, so that it's not drawn when the output of
+// sindr is piped.
+func NewProgress(out io.Writer, enabled bool) *Progress {
+	if !enabled {
+		return nil
+	}
+
+	p := &Progress{out: out, stop: make(chan struct{})}
+	if isTerminal(logger.Output) && isTerminal(out) && !logger.DoLogVerbose {
+		p.live = true
+		go p.tick()
+	}
+
+	return p
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(f.Fd())
+}
+
+// Live reports whether the display is redrawn on the terminal, in which case logs have to be written through the
+// progress for them to scroll above the tasks.
+func (p *Progress) Live() bool {
+	return p != nil && p.live
+}
+
+func (p *Progress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.clear()
+	n, err := p.out.Write(b)
+	p.draw()
+	return n, err
+}
+
+// Start adds a task to the progress display, which is shown as running until it is done.
+func (p *Progress) Start(name string) *ProgressTask {
+	if p == nil {
+		return nil
+	}
+
+	t := &ProgressTask{progress: p, name: name, started: time.Now()}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tasks = append(p.tasks, t)
+	return t
+}
+
+// Stop draws the final status of all tasks and stops updating the display.
+func (p *Progress) Stop() {
+	if p == nil || !p.live {
+		return
+	}
+
+	close(p.stop)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	p.draw()
+	// leave the final status on screen
+	p.drawn = 0
+	p.live = false
+}
+
+func (p *Progress) tick() {
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			p.frame++
+			p.clear()
+			p.draw()
+			p.mu.Unlock()
+		}
+	}
+}
+
+func (p *Progress) clear() {
+	if p.drawn > 0 {
+		// move to the start of the first line drawn and clear everything below it
+		_, _ = fmt.Fprintf(p.out, "\x1b[%dF\x1b[J", p.drawn)
+		p.drawn = 0
+	}
+}
+
+func (p *Progress) draw() {
+	if !p.live {
+		return
+	}
+
+	var b strings.Builder
+	for _, t := range p.tasks {
+		b.WriteString(progressStyle.Render(t.status(p.frame)) + "\n")
+	}
+	_, _ = io.WriteString(p.out, b.String())
+	p.drawn = len(p.tasks)
+}
+
+// ProgressTask is a task shown in the progress display.
+type ProgressTask struct {
+	progress *Progress
+	name     string
+	started  time.Time
+	finished time.Time
+	failed   bool
+}
+
+// Done marks the task as finished.
+func (t *ProgressTask) Done(failed bool) {
+	if t == nil {
+		return
+	}
+
+	p := t.progress
+	p.mu.Lock()
+	t.finished = time.Now()
+	t.failed = failed
+	live := p.live
+	p.mu.Unlock()
+
+	if !live {
+		logger.Log(progressStyle.Render(t.status(0)))
+	}
+}
+
+func (t *ProgressTask) status(frame int) string {
+	if t.finished.IsZero() {
+		return fmt.Sprintf("%s %s %s",
+			spinnerStyle.Render(spinnerFrames[frame%len(spinnerFrames)]),
+			renderPrefix(t.name),
+			formatElapsed(time.Since(t.started)),
+		)
+	}
+
+	icon := successStyle.Render("✓")
+	if t.failed {
+		icon = failedStyle.Render("✗")
+	}
+	return fmt.Sprintf("%s %s %s", icon, renderPrefix(t.name), formatElapsed(t.finished.Sub(t.started)))
+}
+
+func formatElapsed(d time.Duration) string {
+	return elapsedStyle.Render(d.Round(progressInterval).String())
+}
@@ -0,0 +1,67 @@
+package internal_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mbark/sindr/internal/sindrtest"
+)
+
+func TestProgress(t *testing.T) {
+	t.Run("logs the status of tasks when not on a terminal", func(t *testing.T) {
+		writer := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, `
+def test_action(ctx):
+    def build():
+        shell('sleep 0.1')
+
+    def lint():
+        return shell('exit 1')
+
+    start(build)
+    p = pool()
+    p.run(lint, name='lint-all')
+    p.wait()
+    wait()
+
+    service('db', 'sleep 60').stop()
+
+cli(name="TestProgress")
+command(name="test", action=test_action)
+`, sindrtest.WithWriter(writer), sindrtest.WithArgs("--progress", "test"))
+
+		var statuses []string
+		for _, w := range writer.Writes {
+			// the summary of the steps run is logged last
+			if strings.Contains(w, "Summary") {
+				break
+			}
+			if strings.Contains(w, "✓") || strings.Contains(w, "✗") {
+				statuses = append(statuses, w)
+			}
+		}
+
+		assert.Len(t, statuses, 3)
+		assert.Contains(t, strings.Join(statuses, ""), "✗ lint-all")
+		assert.Contains(t, strings.Join(statuses, ""), "✓ build")
+		assert.Contains(t, strings.Join(statuses, ""), "✓ db")
+	})
+
+	t.Run("is disabled by default", func(t *testing.T) {
+		writer := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, `
+def test_action(ctx):
+    start(lambda: None)
+    wait()
+
+cli(name="TestProgress")
+command(name="test", action=test_action)
+`, sindrtest.WithWriter(writer))
+
+		for _, w := range writer.Writes {
+			assert.NotContains(t, w, "✓")
+		}
+	})
+}
@@ -0,0 +1,289 @@
+package internal
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/mbark/sindr/internal/logger"
+)
+
+var (
+	summaryHeaderStyle = lipgloss.NewStyle().Bold(true)
+	summaryStepStyle   = lipgloss.NewStyle().Padding(0, 2)
+)
+
+// Report collects the steps run by a command, every process and task, to summarise how long they took and whether
+// they failed once the command is done.
+type Report struct {
+	mu      sync.Mutex
+	command string
+	started time.Time
+	ended   *logger.CommandEnd
+	steps   []ReportStep
+}
+
+// ReportStep is a process or task run by a command.
+type ReportStep struct {
+	// Kind is "shell" for processes or the kind of task, like "pool".
+	Kind     string          `json:"kind"`
+	Name     string          `json:"name,omitempty"`
+	Command  string          `json:"command,omitempty"`
+	Success  bool            `json:"success"`
+	ExitCode int             `json:"exit_code,omitempty"`
+	Duration logger.Duration `json:"duration_ms"`
+	// Failure is the stderr of a failed process, or the error a task failed with.
+	Failure string `json:"failure,omitempty"`
+
+	started time.Time
+	// processFailed is set for tasks that failed as the process they ran failed, which is its own step.
+	processFailed bool
+}
+
+// NewReport creates a report, which is given the events of the command run with Handle.
+func NewReport() *Report {
+	return &Report{}
+}
+
+// ValidateReportFile checks that a report can be written to the file, by it being either .xml for JUnit or .json.
+func ValidateReportFile(file string) error {
+	switch filepath.Ext(file) {
+	case ".xml", ".json":
+		return nil
+	default:
+		return fmt.Errorf("unknown report format for %s, expected a .xml (JUnit) or .json file", file)
+	}
+}
+
+// Handle adds the steps of a command as they finish.
+func (r *Report) Handle(e logger.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	switch e := e.(type) {
+	case logger.CommandStart:
+		r.command = e.Command
+		r.started = now
+	case logger.CommandEnd:
+		r.ended = &e
+	case logger.ShellEnd:
+		step := ReportStep{
+			Kind:     "shell",
+			Name:     e.Prefix,
+			Command:  e.Command,
+			Success:  e.Success,
+			ExitCode: e.ExitCode,
+			Duration: e.Duration,
+			started:  now.Add(-time.Duration(e.Duration)),
+		}
+		if !e.Success {
+			step.Failure = e.Stderr
+		}
+		r.steps = append(r.steps, step)
+	case logger.TaskFinished:
+		r.steps = append(r.steps, ReportStep{
+			Kind:          e.Kind,
+			Name:          e.Name,
+			Success:       e.Success,
+			Duration:      e.Duration,
+			Failure:       e.Error,
+			started:       now.Add(-time.Duration(e.Duration)),
+			processFailed: e.ProcessFailed,
+		})
+	}
+}
+
+// Steps returns the steps run, in the order they were started.
+func (r *Report) Steps() []ReportStep {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	steps := slices.Clone(r.steps)
+	slices.SortStableFunc(steps, func(a, b ReportStep) int { return a.started.Compare(b.started) })
+	return steps
+}
+
+// Summary renders a table of the steps with how long they took and whether they succeeded. It's only worth showing
+// for commands running several steps, so nothing is returned otherwise, or if no command was run.
+func (r *Report) Summary() []string {
+	r.mu.Lock()
+	ran := r.command != ""
+	r.mu.Unlock()
+
+	steps := r.Steps()
+	if !ran || len(steps) < 2 {
+		return nil
+	}
+
+	nameWidth, commandWidth := 0, 0
+	for _, s := range steps {
+		nameWidth = max(nameWidth, len(s.Name))
+		commandWidth = max(commandWidth, len(s.summaryCommand()))
+	}
+
+	lines := []string{summaryHeaderStyle.Render("Summary")}
+	for _, s := range steps {
+		icon := successStyle.Render("✓")
+		if !s.Success {
+			icon = failedStyle.Render("✗")
+		}
+		lines = append(lines, summaryStepStyle.Render(fmt.Sprintf("%s %s %-*s %s",
+			icon,
+			renderPrefix(fmt.Sprintf("%-*s", nameWidth, s.Name)),
+			commandWidth, s.summaryCommand(),
+			formatElapsed(time.Duration(s.Duration)),
+		)))
+	}
+	return lines
+}
+
+func (s ReportStep) summaryCommand() string {
+	if s.Command == "" {
+		return s.Kind
+	}
+
+	// only the first line of scripts run with exec()
+	line, _, _ := strings.Cut(s.Command, "\n")
+	return line
+}
+
+// WriteFile writes the report to file, as JUnit XML for .xml files and as JSON for .json files.
+func (r *Report) WriteFile(file string) error {
+	var b []byte
+	var err error
+	switch filepath.Ext(file) {
+	case ".xml":
+		b, err = r.junit()
+	case ".json":
+		b, err = r.json()
+	default:
+		return ValidateReportFile(file)
+	}
+	if err != nil {
+		return fmt.Errorf("report: %w", err)
+	}
+
+	if err := os.WriteFile(file, b, 0o600); err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
+	return nil
+}
+
+type reportSummary struct {
+	Command  string          `json:"command"`
+	Success  bool            `json:"success"`
+	Error    string          `json:"error,omitempty"`
+	Duration logger.Duration `json:"duration_ms"`
+	Steps    []ReportStep    `json:"steps"`
+}
+
+func (r *Report) summary() reportSummary {
+	steps := r.Steps()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := reportSummary{Command: r.command, Success: true, Steps: steps}
+	if r.ended != nil {
+		s.Duration = r.ended.Duration
+		s.Error = r.ended.Error
+		s.Success = r.ended.Error == ""
+	}
+	for _, step := range steps {
+		s.Success = s.Success && step.Success
+	}
+	return s
+}
+
+func (r *Report) json() ([]byte, error) {
+	return json.MarshalIndent(r.summary(), "", "  ")
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     float64          `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      float64         `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func (r *Report) junit() ([]byte, error) {
+	s := r.summary()
+
+	suite := junitTestSuite{Name: s.Command, Time: time.Duration(s.Duration).Seconds()}
+	r.mu.Lock()
+	if !r.started.IsZero() {
+		suite.Timestamp = r.started.Format(time.RFC3339)
+	}
+	r.mu.Unlock()
+
+	for _, step := range s.Steps {
+		if step.processFailed {
+			// it's reported as the failure of the process the task ran
+			continue
+		}
+
+		name := step.Name
+		if step.Command != "" {
+			name = strings.TrimSpace(step.Name + " " + step.summaryCommand())
+		}
+
+		c := junitTestCase{
+			Name:      name,
+			ClassName: s.Command + "." + step.Kind,
+			Time:      time.Duration(step.Duration).Seconds(),
+		}
+		if !step.Success {
+			message := "failed"
+			if step.Command != "" {
+				message = fmt.Sprintf("exited with %d", step.ExitCode)
+			}
+			c.Failure = &junitFailure{Message: message, Text: step.Failure}
+			suite.Failures++
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	suite.Tests = len(suite.Cases)
+
+	b, err := xml.MarshalIndent(junitTestSuites{
+		Name:     "sindr",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
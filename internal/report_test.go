@@ -0,0 +1,175 @@
+package internal_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mbark/sindr/internal/sindrtest"
+)
+
+func TestReport(t *testing.T) {
+	script := `
+def test_action(ctx):
+    shell('echo building', prefix='build')
+    def lint():
+        return shell('echo lint failed >&2; exit 2', prefix='lint')
+    p = pool()
+    p.run(lint)
+    p.wait()
+
+cli(name="TestReport")
+command(name="test", action=test_action)
+`
+
+	t.Run("logs a summary of the steps run", func(t *testing.T) {
+		writer := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, script, sindrtest.WithWriter(writer))
+
+		var summary []string
+		for i, w := range writer.Writes {
+			if strings.Contains(w, "Summary") {
+				summary = writer.Writes[i+1:]
+			}
+		}
+		require.Len(t, summary, 3)
+		assert.Regexp(t, `✓ build +echo building +\d`, summary[0])
+		// the pool task and the process it runs start at the same time, so they can be in either order
+		assert.Regexp(t, `✗ lint +pool +\d`, summary[1]+summary[2])
+		assert.Regexp(t, `✗ lint +echo lint failed >&2; exit 2 +\d`, summary[1]+summary[2])
+	})
+
+	t.Run("writes a JSON report", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "summary.json")
+		sindrtest.Test(t, script, sindrtest.WithArgs("--report", file, "test"))
+
+		b, err := os.ReadFile(file)
+		require.NoError(t, err)
+		var report struct {
+			Command string `json:"command"`
+			Success bool   `json:"success"`
+			Steps   []struct {
+				Kind     string `json:"kind"`
+				Name     string `json:"name"`
+				Command  string `json:"command"`
+				Success  bool   `json:"success"`
+				ExitCode int    `json:"exit_code"`
+				Failure  string `json:"failure"`
+			} `json:"steps"`
+		}
+		require.NoError(t, json.Unmarshal(b, &report))
+
+		assert.Equal(t, "test", report.Command)
+		assert.False(t, report.Success)
+		require.Len(t, report.Steps, 3)
+		assert.Equal(t, "shell", report.Steps[0].Kind)
+		assert.Equal(t, "echo building", report.Steps[0].Command)
+		assert.True(t, report.Steps[0].Success)
+
+		steps := report.Steps[1:]
+		if steps[0].Kind != "pool" {
+			steps[0], steps[1] = steps[1], steps[0]
+		}
+		assert.Equal(t, "pool", steps[0].Kind)
+		assert.Equal(t, "lint", steps[0].Name)
+		assert.False(t, steps[0].Success)
+		assert.Equal(t, 2, steps[1].ExitCode)
+		assert.Equal(t, "lint failed", steps[1].Failure)
+	})
+
+	t.Run("writes a JUnit report", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "junit.xml")
+		sindrtest.Test(t, script, sindrtest.WithArgs("--report", file, "test"))
+
+		b, err := os.ReadFile(file)
+		require.NoError(t, err)
+		var report struct {
+			Tests    int `xml:"tests,attr"`
+			Failures int `xml:"failures,attr"`
+			Suites   []struct {
+				Name  string `xml:"name,attr"`
+				Cases []struct {
+					Name      string `xml:"name,attr"`
+					ClassName string `xml:"classname,attr"`
+					Failure   *struct {
+						Message string `xml:"message,attr"`
+						Text    string `xml:",chardata"`
+					} `xml:"failure"`
+				} `xml:"testcase"`
+			} `xml:"testsuite"`
+		}
+		require.NoError(t, xml.Unmarshal(b, &report))
+
+		// the pool task only failed as its process did, which is the one failure reported
+		assert.Equal(t, 2, report.Tests)
+		assert.Equal(t, 1, report.Failures)
+		require.Len(t, report.Suites, 1)
+		cases := report.Suites[0].Cases
+		require.Len(t, cases, 2)
+		assert.Equal(t, "build echo building", cases[0].Name)
+		assert.Equal(t, "test.shell", cases[0].ClassName)
+		assert.Nil(t, cases[0].Failure)
+
+		failed := cases[1]
+		assert.Equal(t, "test.shell", failed.ClassName)
+		require.NotNil(t, failed.Failure)
+		assert.Equal(t, "exited with 2", failed.Failure.Message)
+		assert.Equal(t, "lint failed", failed.Failure.Text)
+	})
+
+	t.Run("reports tasks failing without a process failing", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "junit.xml")
+		sindrtest.Test(t, `
+def test_action(ctx):
+    def lint():
+        shell('echo linting')
+        return False
+    p = pool()
+    p.run(lint)
+    p.wait()
+
+cli(name="TestReport")
+command(name="test", action=test_action)
+`, sindrtest.WithArgs("--report", file, "test"))
+
+		b, err := os.ReadFile(file)
+		require.NoError(t, err)
+		assert.Contains(t, string(b), `tests="2" failures="1"`)
+		assert.Contains(t, string(b), `<failure message="failed">`)
+	})
+
+	t.Run("doesn't log a summary unless a command is run", func(t *testing.T) {
+		script := `
+shell('echo one')
+shell('echo two')
+
+def test_action(ctx):
+    pass
+
+cli(name="TestReport")
+command(name="test", action=test_action, flags=[string_flag(name="env", complete=["dev"])])
+`
+		for _, args := range [][]string{
+			{"test", "--help"},
+			{"__complete", "--", "sindr", "test", "--env", ""},
+		} {
+			writer := new(sindrtest.CollectWriter)
+			sindrtest.Test(t, script, sindrtest.WithArgs(args...), sindrtest.WithWriter(writer))
+			assert.NotContains(t, strings.Join(writer.Writes, ""), "Summary", args)
+		}
+
+		writer := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, script, sindrtest.WithWriter(writer))
+		assert.Contains(t, strings.Join(writer.Writes, ""), "Summary")
+	})
+
+	t.Run("fails for unknown formats", func(t *testing.T) {
+		sindrtest.Test(t, script, sindrtest.WithArgs("--report", "report.txt", "test"), sindrtest.ShouldFail())
+	})
+}
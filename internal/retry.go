@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"go.starlark.net/starlark"
+
+	"github.com/mbark/sindr/internal/logger"
+)
+
+var retryStyle = lipgloss.NewStyle().Foreground(lipgloss.ANSIColor(ansi.Yellow)).Padding(0, 2)
+
+// SindrRetry calls a function until it succeeds, or the attempts run out. A call fails if it raises an error, returns
+// False or returns an unsuccessful shell result.
+func SindrRetry(
+	thread *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	var callable starlark.Callable
+	var delay, backoff starlark.Value
+	attempts := 3
+	if err := starlark.UnpackArgs("retry", args, kwargs,
+		"fn", &callable,
+		"attempts?", &attempts,
+		"delay?", &delay,
+		"backoff?", &backoff,
+	); err != nil {
+		return nil, err
+	}
+	if attempts < 1 {
+		return nil, errors.New("retry: attempts must be at least 1")
+	}
+
+	policy, err := newRetryPolicy(attempts-1, delay, backoff)
+	if err != nil {
+		return nil, fmt.Errorf("retry: %w", err)
+	}
+
+	logger := GetLogger(thread)
+	for attempt := 1; ; attempt++ {
+		res, err := starlark.Call(thread, callable, nil, nil)
+		failed := err != nil || isFailure(res)
+		if !failed || attempt > policy.retries {
+			return res, err
+		}
+
+		reason := "failed"
+		if err != nil {
+			reason = "failed: " + err.Error()
+		}
+		policy.wait(logger, "", attempt, reason)
+	}
+}
+
+// isFailure reports whether a value returned from a function should be seen as a failure.
+func isFailure(v starlark.Value) bool {
+	switch v := v.(type) {
+	case starlark.Bool:
+		return !bool(v)
+	case *ShellResult:
+		return !v.Success
+	case *PipeResult:
+		return !v.Success
+	default:
+		return false
+	}
+}
+
+// isProcessResult returns whether the value is the result of a process, whose failure is reported when it exits.
+func isProcessResult(v starlark.Value) bool {
+	switch v.(type) {
+	case *ShellResult, *PipeResult:
+		return true
+	default:
+		return false
+	}
+}
+
+type retryPolicy struct {
+	retries int
+	delay   time.Duration
+	backoff float64
+}
+
+func newRetryPolicy(retries int, delay, backoff starlark.Value) (*retryPolicy, error) {
+	policy := &retryPolicy{retries: retries, delay: time.Second, backoff: 1}
+	if delay != nil {
+		d, err := parseDuration(delay)
+		if err != nil {
+			return nil, fmt.Errorf("delay: %w", err)
+		}
+		policy.delay = d
+	}
+	if backoff != nil {
+		b, ok := starlark.AsFloat(backoff)
+		if !ok {
+			return nil, fmt.Errorf("backoff: expected number, got %s", backoff.Type())
+		}
+		policy.backoff = b
+	}
+
+	return policy, nil
+}
+
+// wait logs that the given attempt failed and sleeps until the next attempt should be made.
+func (p *retryPolicy) wait(logger logger.Interface, prefix string, attempt int, reason string) {
+	msg := retryStyle.Render(fmt.Sprintf("attempt %d/%d %s, retrying in %s",
+		attempt, p.retries+1, reason, p.delay))
+	if prefix != "" {
+		logger.Log(renderPrefix(prefix), msg)
+	} else {
+		logger.Log(msg)
+	}
+
+	time.Sleep(p.delay)
+	p.delay = time.Duration(float64(p.delay) * p.backoff)
+}
+
+// parseDuration parses a duration given either as a string like "2s" or as a number of seconds.
+func parseDuration(v starlark.Value) (time.Duration, error) {
+	if s, ok := v.(starlark.String); ok {
+		return time.ParseDuration(string(s))
+	}
+
+	f, ok := starlark.AsFloat(v)
+	if !ok {
+		return 0, fmt.Errorf("expected duration string or number of seconds, got %s", v.Type())
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
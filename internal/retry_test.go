@@ -0,0 +1,135 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/mbark/sindr/internal/sindrtest"
+)
+
+const flakyCommand = `n=$(cat count 2>/dev/null || echo 0); n=$((n+1)); echo $n > count; [ $n -ge 3 ] || exit 2`
+
+func TestShellRetries(t *testing.T) {
+	t.Run("retries a failing command", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = shell(flaky, retries=3, retry_delay="10ms")
+    assert_true(result.success)
+    assert_equals(3, result.attempts)
+
+flaky = '`+flakyCommand+`'
+cli(name="TestShellRetries")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("stops when the retries run out", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = shell(flaky, retries=1, retry_delay=0.01, backoff=2.0)
+    assert_false(result.success)
+    assert_equals(2, result.exit_code)
+    assert_equals(2, result.attempts)
+
+flaky = '`+flakyCommand+`'
+cli(name="TestShellRetries")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("only retries on the given exit codes", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = shell(flaky, retries=3, retry_delay="10ms", retry_on=[1])
+    assert_false(result.success)
+    assert_equals(1, result.attempts)
+    result = run(['sh', '-c', flaky], retries=3, retry_delay="10ms", retry_on=[2])
+    assert_true(result.success)
+    assert_equals(2, result.attempts)
+
+flaky = '`+flakyCommand+`'
+cli(name="TestShellRetries")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("passes stdin on every attempt", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = exec('sh', 'read line; echo $line; ' + flaky, stdin='input', retries=3, retry_delay="10ms")
+    assert_true(result.success)
+    assert_equals('input', result.stdout)
+
+flaky = '`+flakyCommand+`'
+cli(name="TestShellRetries")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("sets the environment on every attempt", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = shell('echo $TOKEN; ' + flaky, environ={"TOKEN": "secret"}, retries=3, retry_delay="10ms")
+    assert_true(result.success)
+    assert_equals(3, result.attempts)
+    assert_equals('secret', result.stdout)
+
+flaky = '`+flakyCommand+`'
+cli(name="TestShellRetries")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("a successful command is run once", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = shell('true', retries=3)
+    assert_equals(1, result.attempts)
+
+cli(name="TestShellRetries")
+command(name="test", action=test_action)
+`)
+	})
+}
+
+func TestRetry(t *testing.T) {
+	t.Run("retries a function that fails", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    calls = []
+    def flaky():
+        calls.append(1)
+        if len(calls) < 3:
+            fail("not yet")
+        return "done"
+
+    assert_equals("done", retry(flaky, attempts=3, delay="10ms"))
+    assert_equals(3, len(calls))
+
+cli(name="TestRetry")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("retries a function returning a failed shell result", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = retry(lambda: shell(flaky), attempts=5, delay=0.01)
+    assert_true(result.success)
+    assert_equals('3', shell('cat count').stdout)
+
+flaky = '`+flakyCommand+`'
+cli(name="TestRetry")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("fails when all attempts fail", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    retry(lambda: fail("always"), attempts=2, delay="1ms")
+
+cli(name="TestRetry")
+command(name="test", action=test_action)
+`, sindrtest.ShouldFail())
+	})
+}
@@ -2,12 +2,16 @@ package internal
 
 import (
 	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"go.starlark.net/starlark"
 	"go.starlark.net/starlarkstruct"
 
 	"github.com/mbark/sindr/internal/logger"
+	"github.com/mbark/sindr/internal/trace"
 )
 
 func SindrStart(
@@ -25,20 +29,35 @@ func SindrStart(
 		return nil, errors.New("start() argument must be a callable function")
 	}
 
+	name := callable.Name()
+	if err := starlark.UnpackArgs("start", nil, kwargs, "name?", &name); err != nil {
+		return nil, err
+	}
+
 	wg, err := getWaitGroup(thread)
 	if err != nil {
 		return nil, err
 	}
+	sindrCLI, err := getSindrCLI(thread)
+	if err != nil {
+		return nil, err
+	}
 
+	task := spawnTask(GetLogger(thread), sindrCLI.Progress, logger.TaskStart, name)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 
-		newThread := &starlark.Thread{Name: "async"}
-		_, err := starlark.Call(newThread, callable, starlark.Tuple{}, nil)
+		newThread := newChildThread(thread, "async")
+		span := trace.Begin(newThread, "task", name)
+		res, err := starlark.Call(newThread, callable, starlark.Tuple{}, nil)
 		if err != nil {
-			logger.LogErr("started function failed", err)
+			logger.LogError(logger.Default, "started function failed", err)
 		}
+
+		failed := err != nil || isFailure(res)
+		span.End(map[string]any{"success": !failed})
+		task.Done(err, failed, failed && isProcessResult(res))
 	}()
 
 	return starlark.None, nil
@@ -65,7 +84,22 @@ func SindrPool(
 	args starlark.Tuple,
 	kwargs []starlark.Tuple,
 ) (starlark.Value, error) {
-	pool := &Pool{wg: sync.WaitGroup{}}
+	var output string
+	if err := starlark.UnpackArgs("pool", args, kwargs, "output?", &output); err != nil {
+		return nil, err
+	}
+	if output == "" {
+		sindrCLI, err := getSindrCLI(thread)
+		if err != nil {
+			return nil, err
+		}
+		output = sindrCLI.Output
+	}
+	if err := validateOutputMode(output); err != nil {
+		return nil, fmt.Errorf("pool: %w", err)
+	}
+
+	pool := &Pool{wg: sync.WaitGroup{}, output: output}
 
 	poolMethods := starlark.StringDict{
 		"run":  starlark.NewBuiltin("pool.run", MakePoolRun(pool)),
@@ -96,14 +130,43 @@ func MakePoolRun(pool *Pool) func(
 			return nil, errors.New("pool.run() argument must be a callable function")
 		}
 
+		name := callable.Name()
+		if err := starlark.UnpackArgs("pool.run", nil, kwargs, "name?", &name); err != nil {
+			return nil, err
+		}
+		sindrCLI, err := getSindrCLI(thread)
+		if err != nil {
+			return nil, err
+		}
+
+		task := spawnTask(GetLogger(thread), sindrCLI.Progress, logger.TaskPool, name)
 		pool.wg.Add(1)
 		go func() {
 			defer pool.wg.Done()
 
-			newThread := &starlark.Thread{Name: "pool"}
-			_, err := starlark.Call(newThread, callable, starlark.Tuple{}, nil)
+			newThread := newChildThread(thread, "pool")
+			var buffered *logger.Buffered
+			if pool.output != OutputInterleaved {
+				b := logger.NewBuffered(GetLogger(newThread))
+				buffered = &b
+				newThread.SetLocal("logger", b)
+			}
+
+			span := trace.Begin(newThread, "task", name)
+			res, err := starlark.Call(newThread, callable, starlark.Tuple{}, nil)
 			if err != nil {
-				logger.LogErr("pool function failed", err)
+				logger.LogError(GetLogger(newThread), "pool function failed", err)
+			}
+
+			failed := err != nil || isFailure(res)
+			span.End(map[string]any{"success": !failed})
+			task.Done(err, failed, failed && isProcessResult(res))
+			if buffered != nil {
+				if pool.output == OutputFailedOnly && !failed {
+					buffered.Discard()
+				} else {
+					buffered.Flush()
+				}
 			}
 		}()
 
@@ -128,6 +191,71 @@ func MakePoolWait(pool *Pool) func(
 	}
 }
 
+var taskIDs atomic.Int64
+
+// backgroundTask is a task running in the background, spawned with start(), pool.run() or service().
+type backgroundTask struct {
+	logger   logger.Interface
+	progress *ProgressTask
+	spawned  logger.TaskSpawned
+	started  time.Time
+}
+
+// spawnTask logs that a task has been spawned and adds it to the progress display.
+func spawnTask(l logger.Interface, p *Progress, kind, name string) *backgroundTask {
+	t := &backgroundTask{
+		logger:   l,
+		progress: p.Start(name),
+		spawned:  logger.TaskSpawned{ID: taskIDs.Add(1), Kind: kind, Name: name},
+		started:  time.Now(),
+	}
+	logger.LogEvent(l, t.spawned)
+	return t
+}
+
+// Done logs that the task has finished, with the error it failed with if any. ProcessFailed is set if it failed by
+// returning the result of a process that failed.
+func (t *backgroundTask) Done(err error, failed, processFailed bool) {
+	if t == nil {
+		return
+	}
+
+	t.progress.Done(failed)
+	finished := logger.TaskFinished{
+		ID:            t.spawned.ID,
+		Kind:          t.spawned.Kind,
+		Name:          t.spawned.Name,
+		Success:       !failed,
+		Duration:      logger.Duration(time.Since(t.started)),
+		ProcessFailed: processFailed,
+	}
+	if err != nil {
+		finished.Error = err.Error()
+	}
+	logger.LogEvent(t.logger, finished)
+}
+
 type Pool struct {
-	wg sync.WaitGroup
+	wg     sync.WaitGroup
+	output string
+}
+
+// The output modes control how the output of tasks running concurrently is shown.
+const (
+	// OutputInterleaved shows output as soon as it's written, mixing the output of tasks line by line.
+	OutputInterleaved = "interleaved"
+	// OutputGrouped buffers the output of each task and shows it all at once when the task finishes.
+	OutputGrouped = "grouped"
+	// OutputFailedOnly buffers the output of each task, only showing it if the task fails.
+	OutputFailedOnly = "failed-only"
+)
+
+func validateOutputMode(mode string) error {
+	switch mode {
+	case OutputInterleaved, OutputGrouped, OutputFailedOnly:
+		return nil
+	default:
+		return fmt.Errorf("unknown output mode %q, expected one of %s, %s or %s",
+			mode, OutputInterleaved, OutputGrouped, OutputFailedOnly)
+	}
 }
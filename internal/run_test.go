@@ -1,8 +1,12 @@
 package internal_test
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+
 	"github.com/mbark/sindr/internal/sindrtest"
 )
 
@@ -85,6 +89,99 @@ command(name="test", action=test_action)
 	})
 }
 
+func TestPoolOutput(t *testing.T) {
+	// printed returns the messages printed by the tasks, in the order they were logged
+	printed := func(writer *sindrtest.CollectWriter, markers ...string) []string {
+		var lines []string
+		for _, w := range writer.Writes {
+			for _, m := range markers {
+				if strings.HasSuffix(strings.TrimSpace(w), " "+m) {
+					lines = append(lines, m)
+				}
+			}
+		}
+		return lines
+	}
+
+	script := `
+def test_action(ctx):
+    p = pool(%s)
+
+    def alpha():
+        print('alpha-1')
+        shell('sleep 0.2')
+        print('alpha-2')
+
+    def beta():
+        shell('sleep 0.1')
+        print('beta-1')
+        shell('sleep 0.2')
+        print('beta-2')
+
+    p.run(alpha)
+    p.run(beta)
+    p.wait()
+
+cli(name="TestPoolOutput")
+command(name="test", action=test_action)
+`
+	markers := []string{"alpha-1", "alpha-2", "beta-1", "beta-2"}
+
+	t.Run("interleaves output by default", func(t *testing.T) {
+		writer := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, fmt.Sprintf(script, ""), sindrtest.WithWriter(writer))
+		assert.Equal(t, []string{"alpha-1", "beta-1", "alpha-2", "beta-2"}, printed(writer, markers...))
+	})
+
+	t.Run("groups output per task", func(t *testing.T) {
+		writer := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, fmt.Sprintf(script, "output='grouped'"), sindrtest.WithWriter(writer))
+		assert.Equal(t, []string{"alpha-1", "alpha-2", "beta-1", "beta-2"}, printed(writer, markers...))
+	})
+
+	t.Run("uses the output flag as default", func(t *testing.T) {
+		writer := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, fmt.Sprintf(script, ""),
+			sindrtest.WithWriter(writer),
+			sindrtest.WithArgs("--output", "grouped", "test"))
+		assert.Equal(t, []string{"alpha-1", "alpha-2", "beta-1", "beta-2"}, printed(writer, markers...))
+	})
+
+	t.Run("only shows output of failed tasks", func(t *testing.T) {
+		writer := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, `
+def test_action(ctx):
+    p = pool(output='failed-only')
+
+    def ok():
+        print('ok-task')
+        return shell('exit 0')
+
+    def bad():
+        print('bad-task')
+        return shell('exit 1')
+
+    p.run(ok)
+    p.run(bad)
+    p.wait()
+
+cli(name="TestPoolOutput")
+command(name="test", action=test_action)
+`, sindrtest.WithWriter(writer))
+		assert.Equal(t, []string{"bad-task"}, printed(writer, "ok-task", "bad-task"))
+	})
+
+	t.Run("fails on an unknown output mode", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    pool(output='sorted')
+
+cli(name="TestPoolOutput")
+command(name="test", action=test_action)
+`, sindrtest.ShouldFail())
+	})
+}
+
 func TestAsync(t *testing.T) {
 	t.Run("executes function asynchronously", func(t *testing.T) {
 		sindrtest.Test(t, `
@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"fmt"
+
+	"go.starlark.net/starlark"
+
+	"github.com/mbark/sindr/internal/logger"
+)
+
+var _ starlark.Value = Secret("")
+
+// Secret is a value like an API token that must not be logged. It's shown as *** in Starlark, and its value is
+// redacted from everything logged, but it can be used in templates, as environment variables of processes and as
+// their stdin.
+type Secret string
+
+func (s Secret) String() string        { return logger.Redacted }
+func (s Secret) Type() string          { return "secret" }
+func (s Secret) Freeze()               {}
+func (s Secret) Truth() starlark.Bool  { return s != "" }
+func (s Secret) Hash() (uint32, error) { return starlark.String(s).Hash() }
+
+// NewSecret creates a secret, registering its value to be redacted from all logs.
+func NewSecret(value string) Secret {
+	logger.AddSecret(value)
+	return Secret(value)
+}
+
+func SindrSecret(
+	thread *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	var value starlark.Value
+	if err := starlark.UnpackPositionalArgs("secret", args, kwargs, 1, &value); err != nil {
+		return nil, err
+	}
+
+	switch v := value.(type) {
+	case Secret:
+		return v, nil
+	case starlark.String:
+		return NewSecret(string(v)), nil
+	default:
+		return nil, fmt.Errorf("secret: expected string, got %s", value.Type())
+	}
+}
+
+// secretOrString returns the string or the value of the secret.
+func secretOrString(value starlark.Value) (string, error) {
+	switch v := value.(type) {
+	case starlark.String:
+		return string(v), nil
+	case Secret:
+		return string(v), nil
+	default:
+		return "", fmt.Errorf("expected string or secret, got %s", value.Type())
+	}
+}
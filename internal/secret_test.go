@@ -0,0 +1,93 @@
+package internal_test
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mbark/sindr/internal"
+	"github.com/mbark/sindr/internal/logger"
+	"github.com/mbark/sindr/internal/sindrtest"
+)
+
+func TestSecret(t *testing.T) {
+	t.Run("can be used in templates and env but is redacted from logs", func(t *testing.T) {
+		writer := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, `
+def test_action(ctx):
+    token = secret('hunter22')
+    assert_equals('***', str(token))
+    assert_equals('Bearer hunter22', string('Bearer {{.token}}', token=token))
+
+    res = shell('echo {{.token}}', token=token)
+    assert_equals('hunter22', res.stdout)
+    res = shell('echo $TOKEN', environ={'TOKEN': token})
+    assert_equals('hunter22', res.stdout)
+    res = shell('cat', stdin=token)
+    assert_equals('hunter22', res.stdout)
+
+cli(name="TestSecret")
+command(name="test", action=test_action)
+`, sindrtest.WithWriter(writer))
+
+		logs := strings.Join(writer.Writes, "\n")
+		assert.NotContains(t, logs, "hunter22")
+		assert.Contains(t, logs, "echo ***")
+	})
+
+	t.Run("redacts the values of keys loaded with dotenv", func(t *testing.T) {
+		writer := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, `
+def test_action(ctx):
+    shell('printf "API_TOKEN=s3cr3t-token\nNAME=public-name\n" > .env')
+    dotenv(secrets=['API_TOKEN'])
+    shell('echo $API_TOKEN $NAME')
+
+cli(name="TestSecret")
+command(name="test", action=test_action)
+`, sindrtest.WithWriter(writer))
+
+		// the secret is only known once the .env file has been loaded
+		logs := strings.Join(writer.Writes, "\n")
+		_, loaded, ok := strings.Cut(logs, "loading .env")
+		require.True(t, ok)
+		assert.NotContains(t, loaded, "s3cr3t-token")
+		assert.Contains(t, loaded, "*** public-name")
+	})
+
+	t.Run("redacts secrets from the flags of the command run", func(t *testing.T) {
+		var mu sync.Mutex
+		var started []logger.CommandStart
+		writer := new(sindrtest.CollectWriter)
+		cacheDir := t.TempDir()
+		sindrtest.Test(t, `
+secret('hunter22')
+
+def test_action(ctx):
+    assert_equals('hunter22', ctx.flags.token)
+
+cli(name="TestSecret")
+command(name="test", action=test_action, flags=[string_flag('token')])
+`, sindrtest.WithArgs("test", "--token", "hunter22"), sindrtest.WithWriter(writer), sindrtest.WithCacheDir(cacheDir),
+			sindrtest.WithEventHandler(func(e logger.Event) {
+				mu.Lock()
+				defer mu.Unlock()
+				if s, ok := e.(logger.CommandStart); ok {
+					started = append(started, s)
+				}
+			}))
+
+		require.Len(t, started, 1)
+		require.Len(t, started[0].Flags, 1)
+		assert.Equal(t, "***", started[0].Flags[0].Value)
+		assert.NotContains(t, strings.Join(writer.Writes, "\n"), "hunter22")
+
+		history, err := os.ReadFile(internal.HistoryFile(cacheDir))
+		require.NoError(t, err)
+		assert.NotContains(t, string(history), "hunter22")
+	})
+}
@@ -0,0 +1,413 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/joho/godotenv"
+	"github.com/urfave/cli/v3"
+	"go.starlark.net/starlark"
+
+	"github.com/mbark/sindr/internal/logger"
+	"github.com/mbark/sindr/internal/policy"
+)
+
+var secretsStyle = lipgloss.NewStyle().Bold(true)
+
+const (
+	// secretsHeader starts every encrypted secrets file, to recognise them and the format they're in.
+	secretsHeader = "sindr-secrets:v1:aes-256-gcm"
+	// SecretsKeyEnv is the environment variable the key can be given in instead of a key file, like in CI.
+	SecretsKeyEnv = "SINDR_SECRETS_KEY"
+
+	secretsKeySize = 32
+)
+
+// SindrLoadSecrets decrypts a secrets file, returning a dict of its values as secrets, which are also exported as
+// environment variables with export=True.
+func SindrLoadSecrets(
+	thread *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	var file, keyFile string
+	var export, overload bool
+	if err := starlark.UnpackArgs("load_secrets", args, kwargs,
+		"file", &file,
+		"key_file?", &keyFile,
+		"export?", &export,
+		"overload?", &overload,
+	); err != nil {
+		return nil, err
+	}
+
+	if keyFile == "" {
+		sindrCLI, err := getSindrCLI(thread)
+		if err != nil {
+			return nil, err
+		}
+		keyFile = sindrCLI.SecretsKeyFile
+	}
+
+	for _, f := range []string{file, keyFile} {
+		if err := policy.CheckPath(thread, "load_secrets", f, false); err != nil {
+			return nil, err
+		}
+	}
+	if export {
+		if err := policy.Check(thread, "load_secrets", policy.Env); err != nil {
+			return nil, err
+		}
+	}
+
+	values, err := LoadSecretsFile(file, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load_secrets: %w", err)
+	}
+
+	logger := GetLogger(thread)
+	logger.Log(secretsStyle.Render("loading secrets from " + file))
+
+	d := starlark.NewDict(len(values))
+	for _, k := range slices.Sorted(maps.Keys(values)) {
+		if err := d.SetKey(starlark.String(k), NewSecret(values[k])); err != nil {
+			return nil, err
+		}
+	}
+
+	if export {
+		res := loadEnvMap(values, overload)
+		logEnvResult(logger, res)
+	}
+	return d, nil
+}
+
+// LoadSecretsFile decrypts a secrets file with the key in keyFile, or SecretsKeyEnv if set, returning its values. The
+// decrypted file is parsed as JSON if its name ends with .json or .json.enc and as a .env file otherwise.
+func LoadSecretsFile(file, keyFile string) (map[string]string, error) {
+	key, err := readSecretsKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := decryptSecretsFile(file, key)
+	if err != nil {
+		return nil, err
+	}
+	return parseSecrets(file, plaintext)
+}
+
+func parseSecrets(file string, plaintext []byte) (map[string]string, error) {
+	if !strings.HasSuffix(strings.TrimSuffix(file, ".enc"), ".json") {
+		values, err := godotenv.UnmarshalBytes(plaintext)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", file, err)
+		}
+		return values, nil
+	}
+
+	var values map[string]string
+	if err := json.Unmarshal(plaintext, &values); err != nil {
+		return nil, fmt.Errorf("parse %s, expected an object of strings: %w", file, err)
+	}
+	return values, nil
+}
+
+// readSecretsKey reads the key secrets are encrypted with, which is stored base64 encoded.
+func readSecretsKey(keyFile string) ([]byte, error) {
+	encoded := os.Getenv(SecretsKeyEnv)
+	if encoded == "" {
+		b, err := os.ReadFile(keyFile) // #nosec G304
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no key in %s, create one with 'sindr secrets encrypt' or set %s",
+				keyFile, SecretsKeyEnv)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read key: %w", err)
+		}
+		encoded = string(b)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != secretsKeySize {
+		return nil, fmt.Errorf("invalid key, expected %d base64 encoded bytes", secretsKeySize)
+	}
+	return key, nil
+}
+
+// readOrCreateSecretsKey reads the key, creating a new random key in keyFile if there is none.
+func readOrCreateSecretsKey(keyFile string) ([]byte, error) {
+	if _, err := os.Stat(keyFile); os.Getenv(SecretsKeyEnv) != "" || err == nil {
+		return readSecretsKey(keyFile)
+	}
+
+	key := make([]byte, secretsKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("create key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0o700); err != nil {
+		return nil, fmt.Errorf("create key: %w", err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(key) + "\n"
+	if err := os.WriteFile(keyFile, []byte(encoded), 0o600); err != nil {
+		return nil, fmt.Errorf("create key: %w", err)
+	}
+
+	logger.Log(secretsStyle.Render("created a new key in " + keyFile))
+	return key, nil
+}
+
+func encryptSecrets(plaintext, key []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("encrypt: %w", err)
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, []byte(secretsHeader))
+	return []byte(secretsHeader + "\n" + base64.StdEncoding.EncodeToString(sealed) + "\n"), nil
+}
+
+func decryptSecretsFile(file string, key []byte) ([]byte, error) {
+	b, err := os.ReadFile(file) // #nosec G304
+	if err != nil {
+		return nil, fmt.Errorf("read secrets: %w", err)
+	}
+
+	header, encoded, _ := strings.Cut(string(b), "\n")
+	if header != secretsHeader {
+		return nil, fmt.Errorf("%s isn't an encrypted secrets file", file)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", file, err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("%s is truncated", file)
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(secretsHeader))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt %s, is it encrypted with another key?", file)
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("cipher: %w", err)
+	}
+	return gcm, nil
+}
+
+// SecretsCommand creates the secrets command for sindr run from cwd, to encrypt, decrypt and edit secrets files with
+// the key in keyFile.
+func SecretsCommand(keyFile, cwd string) *cli.Command {
+	keyFlag := func() cli.Flag {
+		return &cli.StringFlag{Name: "key-file", Usage: "the file with the key to use", Value: keyFile}
+	}
+	// the files are given relative to where sindr is run, not the directory of the Starlark file
+	fileArg := func(command *cli.Command) (string, error) {
+		if command.Args().Len() != 1 {
+			return "", errors.New("expected the secrets file as the only argument")
+		}
+		file := command.Args().First()
+		if !filepath.IsAbs(file) && cwd != "" {
+			file = filepath.Join(cwd, file)
+		}
+		return file, nil
+	}
+
+	return &cli.Command{
+		Name:  "secrets",
+		Usage: "Encrypts, decrypts and edits secrets files read with load_secrets()",
+		Commands: []*cli.Command{
+			{
+				Name:      "encrypt",
+				Usage:     "Encrypts a .env or .json file, writing it next to it with .enc before the extension",
+				ArgsUsage: "<file>",
+				Flags: []cli.Flag{
+					keyFlag(),
+					&cli.StringFlag{Name: "out", Aliases: []string{"o"}, Usage: "the file to write to"},
+				},
+				Action: func(ctx context.Context, command *cli.Command) error {
+					file, err := fileArg(command)
+					if err != nil {
+						return err
+					}
+					out := command.String("out")
+					if out == "" {
+						out = EncryptedSecretsFile(file)
+					}
+					return encryptSecretsAction(file, out, command.String("key-file"))
+				},
+			},
+			{
+				Name:      "decrypt",
+				Usage:     "Decrypts a secrets file and prints it",
+				ArgsUsage: "<file>",
+				Flags:     []cli.Flag{keyFlag()},
+				Action: func(ctx context.Context, command *cli.Command) error {
+					file, err := fileArg(command)
+					if err != nil {
+						return err
+					}
+					key, err := readSecretsKey(command.String("key-file"))
+					if err != nil {
+						return err
+					}
+					plaintext, err := decryptSecretsFile(file, key)
+					if err != nil {
+						return err
+					}
+					logger.Print(string(plaintext))
+					return nil
+				},
+			},
+			{
+				Name:      "edit",
+				Usage:     "Opens a secrets file decrypted in $EDITOR, creating it if it doesn't exist",
+				ArgsUsage: "<file>",
+				Flags:     []cli.Flag{keyFlag()},
+				Action: func(ctx context.Context, command *cli.Command) error {
+					file, err := fileArg(command)
+					if err != nil {
+						return err
+					}
+					return editSecretsAction(ctx, file, command.String("key-file"))
+				},
+			},
+		},
+	}
+}
+
+// EncryptedSecretsFile returns the name of the encrypted file for file, like secrets.enc.env for secrets.env.
+func EncryptedSecretsFile(file string) string {
+	ext := filepath.Ext(file)
+	if ext == "" || filepath.Base(file) == ext {
+		// .env has no name before the extension
+		return file + ".enc"
+	}
+	return strings.TrimSuffix(file, ext) + ".enc" + ext
+}
+
+func encryptSecretsAction(file, out, keyFile string) error {
+	plaintext, err := os.ReadFile(file) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("read secrets: %w", err)
+	}
+	if bytes.HasPrefix(plaintext, []byte(secretsHeader)) {
+		return fmt.Errorf("%s is already encrypted", file)
+	}
+	if _, err := parseSecrets(out, plaintext); err != nil {
+		return err
+	}
+
+	key, err := readOrCreateSecretsKey(keyFile)
+	if err != nil {
+		return err
+	}
+	encrypted, err := encryptSecrets(plaintext, key)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(out, encrypted, 0o600); err != nil {
+		return fmt.Errorf("write secrets: %w", err)
+	}
+
+	logger.Log(secretsStyle.Render("encrypted " + file + " to " + out))
+	return nil
+}
+
+func editSecretsAction(ctx context.Context, file, keyFile string) error {
+	key, err := readOrCreateSecretsKey(keyFile)
+	if err != nil {
+		return err
+	}
+
+	var plaintext []byte
+	if _, err := os.Stat(file); err == nil {
+		plaintext, err = decryptSecretsFile(file, key)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the decrypted file keeps the extension, for the editor to highlight it
+	tmp, err := os.CreateTemp("", "sindr-secrets-*"+filepath.Ext(file))
+	if err != nil {
+		return fmt.Errorf("edit: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	_, err = tmp.Write(plaintext)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("edit: %w", err)
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	// the editor is run with a shell as it can have arguments, like "code --wait"
+	cmd := exec.CommandContext(ctx, "sh", "-c", editor+` "$1"`, "sh", tmp.Name()) // #nosec G204
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("edit: %s: %w", editor, err)
+	}
+
+	edited, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return fmt.Errorf("edit: %w", err)
+	}
+	if bytes.Equal(edited, plaintext) {
+		logger.Log(secretsStyle.Render("no changes to " + file))
+		return nil
+	}
+	if _, err := parseSecrets(file, edited); err != nil {
+		return err
+	}
+
+	encrypted, err := encryptSecrets(edited, key)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, encrypted, 0o600); err != nil {
+		return fmt.Errorf("write secrets: %w", err)
+	}
+	logger.Log(secretsStyle.Render("saved " + file))
+	return nil
+}
@@ -0,0 +1,118 @@
+package internal_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mbark/sindr/internal"
+	"github.com/mbark/sindr/internal/logger"
+	"github.com/mbark/sindr/internal/sindrtest"
+)
+
+func TestSecretsFile(t *testing.T) {
+	script := `
+cli(name="TestSecretsFile")
+`
+
+	encrypt := func(t *testing.T, file, contents, keyFile string) string {
+		t.Helper()
+		require.NoError(t, os.WriteFile(file, []byte(contents), 0o600))
+		sindrtest.Test(t, script, sindrtest.WithArgs("secrets", "encrypt", file, "--key-file", keyFile))
+
+		encrypted := internal.EncryptedSecretsFile(file)
+		b, err := os.ReadFile(encrypted)
+		require.NoError(t, err)
+		assert.NotContains(t, string(b), "hunter22")
+		return encrypted
+	}
+
+	t.Run("loads encrypted secrets as secret values", func(t *testing.T) {
+		dir := t.TempDir()
+		keyFile := filepath.Join(dir, "config", "secrets.key")
+		file := encrypt(t, filepath.Join(dir, "secrets.env"), "API_TOKEN=hunter22\n", keyFile)
+		assert.Equal(t, filepath.Join(dir, "secrets.enc.env"), file)
+
+		writer := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, `
+def test_action(ctx):
+    s = load_secrets('`+file+`', key_file='`+keyFile+`')
+    assert_equals('***', str(s['API_TOKEN']))
+    res = shell('echo $API_TOKEN', environ={'API_TOKEN': s['API_TOKEN']})
+    assert_equals('hunter22', res.stdout)
+
+cli(name="TestSecretsFile")
+command(name="test", action=test_action)
+`, sindrtest.WithWriter(writer))
+
+		assert.NotContains(t, strings.Join(writer.Writes, "\n"), "hunter22")
+	})
+
+	t.Run("exports secrets from JSON files", func(t *testing.T) {
+		dir := t.TempDir()
+		keyFile := filepath.Join(dir, "secrets.key")
+		file := encrypt(t, filepath.Join(dir, "secrets.json"), `{"API_TOKEN": "hunter22"}`, keyFile)
+		assert.Equal(t, filepath.Join(dir, "secrets.enc.json"), file)
+
+		sindrtest.Test(t, `
+def test_action(ctx):
+    load_secrets('`+file+`', export=True, overload=True)
+    res = shell('echo $API_TOKEN')
+    assert_equals('hunter22', res.stdout)
+
+cli(name="TestSecretsFile")
+command(name="test", action=test_action)
+`, sindrtest.WithEnv("SINDR_SECRETS_KEY_FILE", keyFile), sindrtest.WithEnv("API_TOKEN", ""))
+	})
+
+	t.Run("decrypts secrets files", func(t *testing.T) {
+		dir := t.TempDir()
+		keyFile := filepath.Join(dir, "secrets.key")
+		file := encrypt(t, filepath.Join(dir, ".env"), "API_TOKEN=hunter22\n", keyFile)
+		assert.Equal(t, filepath.Join(dir, ".env.enc"), file)
+
+		var output bytes.Buffer
+		sindrtest.Test(t, script, sindrtest.WithArgs("secrets", "decrypt", file, "--key-file", keyFile),
+			sindrtest.WithLogger(logger.Logger{}), sindrtest.WithWriter(io.Discard), sindrtest.WithOutput(&output))
+		assert.Equal(t, "API_TOKEN=hunter22\n", output.String())
+	})
+
+	t.Run("edits secrets files", func(t *testing.T) {
+		dir := t.TempDir()
+		keyFile := filepath.Join(dir, "secrets.key")
+		file := filepath.Join(dir, "secrets.enc.env")
+
+		sindrtest.Test(t, script, sindrtest.WithArgs("secrets", "edit", file, "--key-file", keyFile),
+			sindrtest.WithEnv("VISUAL", "echo API_TOKEN=hunter22 >"))
+		sindrtest.Test(t, script, sindrtest.WithArgs("secrets", "edit", file, "--key-file", keyFile),
+			sindrtest.WithEnv("VISUAL", "sed -i s/hunter22/hunter23/"))
+
+		values, err := internal.LoadSecretsFile(file, keyFile)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"API_TOKEN": "hunter23"}, values)
+	})
+
+	t.Run("can't be decrypted with another key", func(t *testing.T) {
+		dir := t.TempDir()
+		file := encrypt(t, filepath.Join(dir, "a.env"), "API_TOKEN=hunter22\n", filepath.Join(dir, "a.key"))
+		encrypt(t, filepath.Join(dir, "b.env"), "API_TOKEN=hunter22\n", filepath.Join(dir, "b.key"))
+
+		_, err := internal.LoadSecretsFile(file, filepath.Join(dir, "b.key"))
+		require.ErrorContains(t, err, "is it encrypted with another key?")
+	})
+
+	t.Run("doesn't encrypt files twice", func(t *testing.T) {
+		dir := t.TempDir()
+		keyFile := filepath.Join(dir, "secrets.key")
+		file := encrypt(t, filepath.Join(dir, "secrets.env"), "API_TOKEN=hunter22\n", keyFile)
+
+		sindrtest.Test(t, script, sindrtest.WithArgs("secrets", "encrypt", file, "--key-file", keyFile),
+			sindrtest.WithLogger(logger.Logger{}), sindrtest.WithWriter(io.Discard), sindrtest.ShouldFail())
+	})
+}
@@ -0,0 +1,424 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"go.starlark.net/starlark"
+
+	"github.com/mbark/sindr/internal/logger"
+	"github.com/mbark/sindr/internal/policy"
+)
+
+var (
+	serviceStyle = lipgloss.NewStyle().Foreground(lipgloss.ANSIColor(ansi.Green)).Padding(0, 2)
+
+	// serviceStopTimeout is how long a service is given to stop before it is killed.
+	serviceStopTimeout = 5 * time.Second
+	readinessInterval  = 100 * time.Millisecond
+)
+
+// SindrService starts a long-running process in the background and waits for it to be ready. Services are stopped
+// in reverse order when the command finishes, or when sindr is interrupted.
+func SindrService(
+	thread *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	var name string
+	var command starlark.Value
+	var ready *starlark.Dict
+	var timeout starlark.Value
+	if err := starlark.UnpackArgs("service", args, kwargs,
+		"name", &name,
+		"cmd", &command,
+		"ready?", &ready,
+		"timeout?", &timeout,
+	); err != nil {
+		return nil, err
+	}
+
+	argv, err := commandArgv(thread, command)
+	if err != nil {
+		return nil, fmt.Errorf("cmd: %w", err)
+	}
+
+	probe, err := parseReadiness(ready)
+	if err != nil {
+		return nil, fmt.Errorf("ready: %w", err)
+	}
+	if probe != nil && (probe.url != "" || probe.address != "") {
+		if err := policy.Check(thread, "service", policy.Network); err != nil {
+			return nil, err
+		}
+	}
+
+	readyTimeout := 30 * time.Second
+	if timeout != nil {
+		readyTimeout, err = parseDuration(timeout)
+		if err != nil {
+			return nil, fmt.Errorf("timeout: %w", err)
+		}
+	}
+
+	sindrCLI, err := getSindrCLI(thread)
+	if err != nil {
+		return nil, err
+	}
+
+	task := spawnTask(GetLogger(thread), sindrCLI.Progress, logger.TaskService, name)
+	logger := GetLogger(thread)
+	logStart(logger, name, quoteArgv(argv))
+
+	svc, err := startService(name, argv, probe, task, func(stream, line string) {
+		logOutput(logger, name, stream, line)
+	})
+	if err != nil {
+		task.Done(err, true, false)
+		return nil, err
+	}
+	sindrCLI.addService(svc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), readyTimeout)
+	defer cancel()
+
+	if err := svc.waitReady(ctx, probe); err != nil {
+		svc.Stop()
+		return nil, fmt.Errorf("service %s: %w", name, err)
+	}
+
+	logger.Log(renderPrefix(name), serviceStyle.Render("ready"))
+	return svc, nil
+}
+
+// commandArgv returns the arguments for a command given either as a list of arguments or a string that is run with
+// the shell.
+func commandArgv(thread *starlark.Thread, command starlark.Value) ([]string, error) {
+	switch v := command.(type) {
+	case *starlark.List:
+		return parseArgv(v)
+	case starlark.String:
+		shell, err := resolveShell(thread, nil)
+		if err != nil {
+			return nil, err
+		}
+		return append(slices.Clone(shell), string(v)), nil
+	default:
+		return nil, fmt.Errorf("expected string or list, got %s", command.Type())
+	}
+}
+
+// readiness describes how to check if a service is ready, only one of the fields is set.
+type readiness struct {
+	address string
+	log     *regexp.Regexp
+	url     string
+}
+
+func parseReadiness(ready *starlark.Dict) (*readiness, error) {
+	if ready == nil {
+		return nil, nil
+	}
+
+	host := "localhost"
+	if v, ok, _ := ready.Get(starlark.String("host")); ok {
+		h, err := castString(v)
+		if err != nil {
+			return nil, fmt.Errorf("host: %w", err)
+		}
+		host = h
+	}
+
+	if v, ok, _ := ready.Get(starlark.String("port")); ok {
+		port, err := castInt(v)
+		if err != nil {
+			return nil, fmt.Errorf("port: %w", err)
+		}
+		return &readiness{address: net.JoinHostPort(host, fmt.Sprint(port))}, nil
+	}
+
+	if v, ok, _ := ready.Get(starlark.String("log")); ok {
+		pattern, err := castString(v)
+		if err != nil {
+			return nil, fmt.Errorf("log: %w", err)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("log: %w", err)
+		}
+		return &readiness{log: re}, nil
+	}
+
+	if v, ok, _ := ready.Get(starlark.String("http")); ok {
+		url, err := castString(v)
+		if err != nil {
+			return nil, fmt.Errorf("http: %w", err)
+		}
+		return &readiness{url: url}, nil
+	}
+
+	return nil, errors.New("expected one of port, log or http")
+}
+
+// startService starts the process in its own process group, calling log for each line of output. The task is marked
+// as done when the process exits, failed unless it exited successfully or was stopped.
+func startService(
+	name string,
+	argv []string,
+	probe *readiness,
+	task *backgroundTask,
+	log func(stream, line string),
+) (*Service, error) {
+	cmd := exec.Command(argv[0], argv[1:]...) // #nosec G204
+	setProcessGroup(cmd)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stdout pipe: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stderr pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("service %s: cmd start: %w", name, err)
+	}
+
+	svc := &Service{
+		name:     name,
+		cmd:      cmd,
+		started:  time.Now(),
+		logReady: make(chan struct{}),
+		exited:   make(chan struct{}),
+	}
+
+	var readyOnce sync.Once
+	scan := func(r io.Reader, stream string) {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := scanner.Text()
+			log(stream, line)
+			if probe != nil && probe.log != nil && probe.log.MatchString(line) {
+				readyOnce.Do(func() { close(svc.logReady) })
+			}
+		}
+		_, _ = io.Copy(io.Discard, r)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); scan(stdout, logger.StreamStdout) }()
+	go func() { defer wg.Done(); scan(stderr, logger.StreamStderr) }()
+	go func() {
+		wg.Wait()
+		svc.err = cmd.Wait()
+		svc.exitedAt = time.Now()
+		failed := !svc.stopped.Load() && !cmd.ProcessState.Success()
+		if failed {
+			task.Done(svc.err, true, false)
+		} else {
+			task.Done(nil, false, false)
+		}
+		close(svc.exited)
+	}()
+
+	return svc, nil
+}
+
+var (
+	_ starlark.Value    = (*Service)(nil)
+	_ starlark.HasAttrs = (*Service)(nil)
+)
+
+// Service is a process started with service(), running until it is stopped.
+type Service struct {
+	name     string
+	cmd      *exec.Cmd
+	started  time.Time
+	exitedAt time.Time
+
+	logReady chan struct{}
+	exited   chan struct{}
+	err      error
+	stopOnce sync.Once
+	stopped  atomic.Bool
+}
+
+func (s *Service) waitReady(ctx context.Context, probe *readiness) error {
+	if probe == nil {
+		return nil
+	}
+
+	ready := s.logReady
+	if probe.log == nil {
+		ready = make(chan struct{})
+		go func() {
+			if pollReady(ctx, probe) {
+				close(ready)
+			}
+		}()
+	}
+
+	select {
+	case <-ready:
+		return nil
+	case <-s.exited:
+		return fmt.Errorf("exited before being ready: %v", s.err)
+	case <-ctx.Done():
+		return errors.New("timed out waiting to be ready")
+	}
+}
+
+// pollReady checks the port or url until it responds, returning false if the context is done first.
+func pollReady(ctx context.Context, probe *readiness) bool {
+	client := &http.Client{Timeout: readinessInterval * 5}
+	check := func() bool {
+		if probe.address != "" {
+			conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", probe.address)
+			if err != nil {
+				return false
+			}
+			_ = conn.Close()
+			return true
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, probe.url, nil)
+		if err != nil {
+			return false
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			return false
+		}
+		_ = res.Body.Close()
+		return res.StatusCode >= 200 && res.StatusCode < 400
+	}
+
+	ticker := time.NewTicker(readinessInterval)
+	defer ticker.Stop()
+	for {
+		if check() {
+			return true
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop stops the service, killing it if it doesn't stop within serviceStopTimeout.
+func (s *Service) Stop() {
+	s.stopOnce.Do(func() {
+		select {
+		case <-s.exited:
+			return
+		default:
+		}
+
+		s.stopped.Store(true)
+		_ = terminate(s.cmd)
+		select {
+		case <-s.exited:
+		case <-time.After(serviceStopTimeout):
+			_ = kill(s.cmd)
+			<-s.exited
+		}
+	})
+}
+
+func (s *Service) stop(
+	thread *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	s.Stop()
+	return starlark.None, nil
+}
+
+func (s *Service) String() string        { return "<service " + s.name + ">" }
+func (s *Service) Type() string          { return "service" }
+func (s *Service) Freeze()               {}
+func (s *Service) Truth() starlark.Bool  { return starlark.True }
+func (s *Service) Hash() (uint32, error) { return starlark.String(s.name).Hash() }
+
+func (s *Service) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "name":
+		return starlark.String(s.name), nil
+	case "pid":
+		return starlark.MakeInt(s.cmd.Process.Pid), nil
+	case "stop":
+		return starlark.NewBuiltin("stop", s.stop), nil
+	default:
+		return nil, nil
+	}
+}
+
+func (s *Service) AttrNames() []string {
+	return []string{"name", "pid", "stop"}
+}
+
+func (c *CLI) addService(s *Service) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.services = append(c.services, s)
+}
+
+// StopServices stops all services started with service(), in the reverse order of how they were started.
+func (c *CLI) StopServices() {
+	c.mu.Lock()
+	services := c.services
+	c.services = nil
+	c.mu.Unlock()
+
+	for _, s := range slices.Backward(services) {
+		s.Stop()
+	}
+}
+
+// StopServicesOnSignal stops all services when sindr is interrupted, and then lets the signal terminate sindr as it
+// would have otherwise. The returned function stops listening for signals.
+func (c *CLI) StopServicesOnSignal() func() {
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-done:
+		case sig := <-sigs:
+			c.StopServices()
+			signal.Stop(sigs)
+			if p, err := os.FindProcess(os.Getpid()); err != nil || p.Signal(sig) != nil {
+				os.Exit(1)
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
@@ -0,0 +1,102 @@
+package internal_test
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mbark/sindr/internal/sindrtest"
+)
+
+func TestService(t *testing.T) {
+	t.Run("waits for a port to be ready", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = l.Close() })
+		port := l.Addr().(*net.TCPAddr).Port
+
+		sindrtest.Test(t, fmt.Sprintf(`
+def test_action(ctx):
+    svc = service('db', 'sleep 60', ready={'port': %d, 'host': '127.0.0.1'})
+    assert_equals('db', svc.name)
+    assert_non_zero(svc.pid)
+    svc.stop()
+
+cli(name="TestService")
+command(name="test", action=test_action)
+`, port))
+	})
+
+	t.Run("waits for a log line to match", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    service('api', 'echo starting; sleep 0.2; echo listening on 8080; sleep 60', ready={'log': 'listening on \\d+'})
+
+cli(name="TestService")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("waits for an http url to respond", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		t.Cleanup(srv.Close)
+
+		sindrtest.Test(t, fmt.Sprintf(`
+def test_action(ctx):
+    service('web', ['sleep', '60'], ready={'http': '%s'})
+
+cli(name="TestService")
+command(name="test", action=test_action)
+`, srv.URL))
+	})
+
+	t.Run("fails if not ready before the timeout", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    service('api', 'sleep 60', ready={'log': 'never'}, timeout='200ms')
+
+cli(name="TestService")
+command(name="test", action=test_action)
+`, sindrtest.ShouldFail())
+	})
+
+	t.Run("fails if the process exits before being ready", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    service('api', 'exit 1', ready={'log': 'never'})
+
+cli(name="TestService")
+command(name="test", action=test_action)
+`, sindrtest.ShouldFail())
+	})
+
+	t.Run("stops services when the command finishes", func(t *testing.T) {
+		pidFile := filepath.Join(t.TempDir(), "pid")
+		sindrtest.Test(t, fmt.Sprintf(`
+def test_action(ctx):
+    service('first', 'echo $$ > %s; echo up; exec sleep 60', ready={'log': 'up'})
+    service('second', 'sleep 60')
+
+cli(name="TestService")
+command(name="test", action=test_action)
+`, pidFile))
+
+		b, err := os.ReadFile(pidFile)
+		require.NoError(t, err)
+		pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+		require.NoError(t, err)
+
+		p, err := os.FindProcess(pid)
+		require.NoError(t, err)
+		require.Error(t, p.Signal(syscall.Signal(0)), "service should have been stopped")
+	})
+}
@@ -3,16 +3,23 @@ package internal
 import (
 	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os/exec"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/x/ansi"
+	starlarkjson "go.starlark.net/lib/json"
 	"go.starlark.net/starlark"
 
 	"github.com/mbark/sindr/internal/logger"
+	"github.com/mbark/sindr/internal/trace"
 )
 
 var (
@@ -22,15 +29,9 @@ var (
 	commandStyleVerbose = commandStyle.
 				Padding(0, 2).
 				Bold(false)
-	stdoutStyle = lipgloss.NewStyle().
-			Faint(true).
-			Padding(0, 2)
-	stderrStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.ANSIColor(ansi.Red)).
-			Padding(0, 2)
-	prefixStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.ANSIColor(ansi.BrightBlack)).
-			Faint(true)
+	interpreterStyle = lipgloss.NewStyle().
+				Faint(true).
+				Padding(0, 2)
 )
 
 func SindrShell(
@@ -39,77 +40,200 @@ func SindrShell(
 	args starlark.Tuple,
 	kwargs []starlark.Tuple,
 ) (starlark.Value, error) {
-	relevantKwargs, otherKwargs := splitKwargs(kwargs, "command", "prefix", "no_output")
-	fmt.Println(relevantKwargs, otherKwargs)
+	relevantKwargs, otherKwargs := splitKwargs(kwargs,
+		append([]string{"command", "interpreter"}, processKwargs...)...)
 
-	var command, prefix string
-	var noOutput bool
-	if err := starlark.UnpackArgs("shell", args, relevantKwargs,
+	var command string
+	var interpreter starlark.Value
+	opts := newProcessOptions()
+	if err := starlark.UnpackArgs("shell", args, relevantKwargs, append([]any{
 		"command", &command,
-		"prefix?", &prefix,
-		"no_output?", &noOutput,
-	); err != nil {
+		"interpreter?", &interpreter,
+	}, opts.unpackPairs()...)...); err != nil {
 		return nil, err
 	}
+	if err := opts.checkPolicy(thread, "shell"); err != nil {
+		return nil, err
+	}
+	prefix := opts.prefix
+	logger := GetLogger(thread)
+
+	shell, err := resolveShell(thread, interpreter)
+	if err != nil {
+		return nil, err
+	}
+	if interpreter != nil {
+		if err := CheckShell(shell); err != nil {
+			return nil, fmt.Errorf("interpreter: %w", err)
+		}
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	if prefix != "" {
-		logger.Log(prefixStyle.Render(prefix), commandStyleVerbose.Render(command))
-	} else {
-		logger.Log(commandStyleVerbose.Render(command))
-	}
-
-	command, err := evaluateTemplateString(command, thread, otherKwargs)
+	// the command is logged as written, the templated command is only logged verbosely
+	logStart(logger, prefix, command)
+	command, err = evaluateTemplateString(command, thread, otherKwargs)
 	if err != nil {
 		return nil, err
 	}
 
-	logger := logger.WithStack(thread.CallStack())
+	span := trace.Begin(thread, "shell", command)
 	if prefix != "" {
-		logger.LogVerbose(prefixStyle.Render(prefix) + " " + commandStyle.Render("$ "+command))
+		logger.LogVerbose(renderPrefix(prefix) + " " + commandStyle.Render("$ "+command))
 	} else {
 		logger.LogVerbose(commandStyle.Render("$ " + command))
 	}
+	logInterpreter(logger, prefix, shell)
 
-	cmd := exec.CommandContext(ctx, "sh", "-c", command) // #nosec G204
+	newCmd := func() *exec.Cmd {
+		return exec.CommandContext(ctx, shell[0], append(slices.Clone(shell[1:]), command)...) // #nosec G204
+	}
 	if prefix != "" {
-		logger.LogVerbose(prefixStyle.Render(prefix), commandStyleVerbose.Render(cmd.String()))
+		logger.LogVerbose(renderPrefix(prefix), commandStyleVerbose.Render(newCmd().String()))
 	} else {
-		logger.LogVerbose(commandStyleVerbose.Render(cmd.String()))
+		logger.LogVerbose(commandStyleVerbose.Render(newCmd().String()))
 	}
 
-	res, err := StartShellCmd(logger, cmd, prefix, noOutput)
+	res, err := opts.start(logger, newCmd)
 	if err != nil {
 		return nil, fmt.Errorf("start shell cmd failed: %w", err)
 	}
 
+	res.Command = command
+	span.End(res.traceArgs())
+	logEnd(logger, prefix, res)
 	return res, nil
 }
 
+// defaultShell is used when no interpreter has been configured.
+var defaultShell = []string{"sh", "-c"}
+
+// resolveShell returns the interpreter to run a command with. An interpreter given to the builtin takes precedence,
+// followed by the one set with cli(shell=...) or the config, falling back to defaultShell.
+func resolveShell(thread *starlark.Thread, interpreter starlark.Value) ([]string, error) {
+	if interpreter != nil {
+		shell, err := parseInterpreter(interpreter)
+		if err != nil {
+			return nil, fmt.Errorf("interpreter: %w", err)
+		}
+		return shell, nil
+	}
+
+	if sindrCLI, err := getSindrCLI(thread); err == nil && len(sindrCLI.Shell) > 0 {
+		return sindrCLI.Shell, nil
+	}
+
+	return defaultShell, nil
+}
+
+// parseInterpreter parses an interpreter given either as a list, like ["bash", "-c"], or as a string which is split
+// on whitespace, like "bash -c".
+func parseInterpreter(v starlark.Value) ([]string, error) {
+	var shell []string
+	switch v := v.(type) {
+	case starlark.String:
+		shell = strings.Fields(string(v))
+	case *starlark.List:
+		var err error
+		shell, err = fromList(v, func(value starlark.Value) (string, error) { return castString(value) })
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("expected string or list of strings, got %s", v.Type())
+	}
+
+	if len(shell) == 0 {
+		return nil, errors.New("must not be empty")
+	}
+	return shell, nil
+}
+
+// CheckShell returns an error if the shell doesn't end with the flag to run a command, like -c, as the command would
+// then be run as the path of a script.
+func CheckShell(shell []string) error {
+	if len(shell) == 0 {
+		return errors.New("must not be empty")
+	}
+
+	last := shell[len(shell)-1]
+	if len(shell) < 2 || (!strings.HasPrefix(last, "-") && !strings.EqualFold(last, "/c")) {
+		return fmt.Errorf("%q doesn't end with the flag to run a command, like -c", strings.Join(shell, " "))
+	}
+	return nil
+}
+
+func logInterpreter(logger logger.Interface, prefix string, shell []string) {
+	msg := interpreterStyle.Render("interpreter: " + strings.Join(shell, " "))
+	if prefix != "" {
+		logger.LogVerbose(renderPrefix(prefix), msg)
+	} else {
+		logger.LogVerbose(msg)
+	}
+}
+
+// ShellOption configures how StartShellCmd handles the output of a command.
+type ShellOption func(o *shellOptions)
+
+type shellOptions struct {
+	stdout, stderr io.Writer
+	tee            bool
+}
+
+// WithOutputFiles also writes stdout and stderr of the command to the given writers, if non-nil. The output is always
+// captured, and also logged when tee is set.
+func WithOutputFiles(stdout, stderr io.Writer, tee bool) ShellOption {
+	return func(o *shellOptions) {
+		o.stdout = stdout
+		o.stderr = stderr
+		o.tee = tee
+	}
+}
+
 func StartShellCmd(
-	logger logger.Interface,
+	l logger.Interface,
 	cmd *exec.Cmd,
 	name string,
 	noOutput bool,
+	opts ...ShellOption,
 ) (*ShellResult, error) {
-	stdoutPipe, err := cmd.StdoutPipe()
+	var options shellOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	outputPipe := func(w io.Writer, pipe func() (io.ReadCloser, error)) (io.Reader, error) {
+		r, err := pipe()
+		if err != nil {
+			return nil, err
+		}
+		if w != nil {
+			return io.TeeReader(r, w), nil
+		}
+		return r, nil
+	}
+
+	stdoutPipe, err := outputPipe(options.stdout, cmd.StdoutPipe)
 	if err != nil {
 		return nil, fmt.Errorf("stdout pipe: %w", err)
 	}
 
-	stderrPipe, err := cmd.StderrPipe()
+	stderrPipe, err := outputPipe(options.stderr, cmd.StderrPipe)
 	if err != nil {
 		return nil, fmt.Errorf("stderr pipe: %w", err)
 	}
 
+	started := time.Now()
 	if err := cmd.Start(); err != nil {
 		return nil, fmt.Errorf("cmd start: %w", err)
 	}
 
+	var wg sync.WaitGroup
 	var stdoutBuilder, stderrBuilder strings.Builder
-	scan := func(pipe io.ReadCloser, builder *strings.Builder, style lipgloss.Style) {
+	scan := func(pipe io.Reader, builder *strings.Builder, stream string, log bool) {
+		defer wg.Done()
+
 		scanner := bufio.NewScanner(pipe)
 		scanner.Split(bufio.ScanLines)
 		for scanner.Scan() {
@@ -118,16 +242,18 @@ func StartShellCmd(
 			if !noOutput {
 				builder.WriteString(m + "\n")
 			}
-			if name != "" {
-				logger.Log(prefixStyle.Render(name), style.Render(m))
-			} else {
-				logger.Log(style.Render(m))
+			if log {
+				logOutput(l, name, stream, m)
 			}
 		}
+		// make sure everything is read, including anything after a line too long to scan
+		_, _ = io.Copy(io.Discard, pipe)
 	}
 
-	scan(stdoutPipe, &stdoutBuilder, stdoutStyle)
-	scan(stderrPipe, &stderrBuilder, stderrStyle)
+	wg.Add(2)
+	go scan(stdoutPipe, &stdoutBuilder, logger.StreamStdout, options.stdout == nil || options.tee)
+	go scan(stderrPipe, &stderrBuilder, logger.StreamStderr, options.stderr == nil || options.tee)
+	wg.Wait()
 	err = cmd.Wait()
 	stdout, stderr := strings.TrimSpace(
 		stdoutBuilder.String(),
@@ -141,6 +267,10 @@ func StartShellCmd(
 				Stderr:   stderr,
 				Success:  exitErr.Success(),
 				ExitCode: exitErr.ExitCode(),
+				Attempts: 1,
+				Duration: time.Since(started),
+				Command:  quoteArgv(cmd.Args),
+				Pid:      cmd.Process.Pid,
 			}, nil
 		}
 
@@ -152,9 +282,46 @@ func StartShellCmd(
 		Stderr:   stderr,
 		Success:  cmd.ProcessState.Success(),
 		ExitCode: cmd.ProcessState.ExitCode(),
+		Attempts: 1,
+		Duration: time.Since(started),
+		Command:  quoteArgv(cmd.Args),
+		Pid:      cmd.Process.Pid,
 	}, err
 }
 
+// renderPrefix renders a prefix in its colour, see logger.RenderPrefix.
+func renderPrefix(prefix string) string {
+	return logger.RenderPrefix(prefix)
+}
+
+// logStart logs that a process is started, prefixed by name if one is given.
+func logStart(l logger.Interface, name, command string) {
+	logger.LogEvent(l, logger.ShellStart{Prefix: name, Command: command})
+}
+
+// logScript logs that a script is started, which is only shown when logging verbosely.
+func logScript(l logger.Interface, name, script string) {
+	logger.LogEvent(l, logger.NewScriptStart(name, script))
+}
+
+// logEnd logs that a process has exited.
+func logEnd(l logger.Interface, name string, res *ShellResult) {
+	logger.LogEvent(l, logger.ShellEnd{
+		Prefix:   name,
+		Command:  res.Command,
+		ExitCode: res.ExitCode,
+		Success:  res.Success,
+		Attempts: res.Attempts,
+		Duration: logger.Duration(res.Duration),
+		Stderr:   res.Stderr,
+	})
+}
+
+// logOutput logs a line of output from a process, prefixed by name if one is given.
+func logOutput(l logger.Interface, name, stream, line string) {
+	logger.LogEvent(l, logger.ShellOutput{Prefix: name, Stream: stream, Line: line})
+}
+
 var (
 	_ starlark.Value    = (*ShellResult)(nil)
 	_ starlark.HasAttrs = (*ShellResult)(nil)
@@ -165,6 +332,11 @@ type ShellResult struct {
 	Stderr   string
 	ExitCode int
 	Success  bool
+	Attempts int
+	Duration time.Duration
+	// Command is the command that was run, after templating.
+	Command string
+	Pid     int
 }
 
 func (s ShellResult) Attr(name string) (starlark.Value, error) {
@@ -177,13 +349,91 @@ func (s ShellResult) Attr(name string) (starlark.Value, error) {
 		return starlark.MakeInt(s.ExitCode), nil
 	case "success":
 		return starlark.Bool(s.Success), nil
+	case "attempts":
+		return starlark.MakeInt(s.Attempts), nil
+	case "duration":
+		return starlark.MakeInt64(s.Duration.Milliseconds()), nil
+	case "lines":
+		return toList(s.lines(), func(l string) starlark.Value { return starlark.String(l) }), nil
+	case "json":
+		return starlark.NewBuiltin("json", s.json), nil
+	case "command":
+		return starlark.String(s.Command), nil
+	case "pid":
+		return starlark.MakeInt(s.Pid), nil
 	default:
 		return nil, nil
 	}
 }
 
 func (s ShellResult) AttrNames() []string {
-	return []string{"stdout", "stderr", "exit_code", "success"}
+	return []string{
+		"stdout", "stderr", "exit_code", "success", "attempts",
+		"duration", "lines", "json", "command", "pid",
+	}
+}
+
+// traceArgs describes how the process went in its trace span.
+func (s ShellResult) traceArgs() map[string]any {
+	return map[string]any{"exit_code": s.ExitCode, "success": s.Success, "attempts": s.Attempts}
+}
+
+func (s ShellResult) lines() []string {
+	if s.Stdout == "" {
+		return nil
+	}
+	return strings.Split(s.Stdout, "\n")
+}
+
+// json parses stdout as JSON, failing with the byte offset of the error if it isn't valid. Commands like
+// `go list -json` print several values one after the other, which are returned as a list.
+func (s ShellResult) json(
+	thread *starlark.Thread,
+	fn *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+
+	decode := starlarkjson.Module.Members["decode"]
+	dec := json.NewDecoder(strings.NewReader(s.Stdout))
+	var values []starlark.Value
+	for {
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: at byte offset %d: %w", fn.Name(), jsonErrorOffset(s.Stdout, err), err)
+		}
+
+		v, err := starlark.Call(thread, decode, starlark.Tuple{starlark.String(raw)}, nil)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+
+	switch len(values) {
+	case 0:
+		return nil, fmt.Errorf("%s: at byte offset %d: no JSON value in stdout", fn.Name(), len(s.Stdout))
+	case 1:
+		return values[0], nil
+	default:
+		return starlark.NewList(values), nil
+	}
+}
+
+// jsonErrorOffset returns the offset of the byte in data that err is for, which is the end for truncated values.
+func jsonErrorOffset(data string, err error) int64 {
+	if serr, ok := errorAs[*json.SyntaxError](err); ok {
+		// the offset is that of the byte after the invalid one
+		return serr.Offset - 1
+	}
+	return int64(len(data))
 }
 
 func (s ShellResult) String() string {
@@ -1,8 +1,14 @@
 package internal_test
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
 	"github.com/mbark/sindr/internal/sindrtest"
 )
 
@@ -319,3 +325,284 @@ command(name="test", action=test_action)
 `)
 	})
 }
+
+func TestShellInterpreter(t *testing.T) {
+	t.Run("defaults to sh", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = shell('echo $0')
+    assert_equals('sh', result.stdout)
+
+cli(name="TestShellInterpreter")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("uses the interpreter set on cli", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = shell('arr=(a b c); [[ ${#arr[@]} == 3 ]] && echo $0')
+    assert_equals('bash', result.stdout)
+
+cli(name="TestShellInterpreter", shell=["bash", "-euo", "pipefail", "-c"])
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("uses the interpreter set on cli in started functions", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    start(lambda: assert_equals('bash', shell('echo $0').stdout))
+    wait()
+
+cli(name="TestShellInterpreter", shell="bash -c")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("uses the interpreter from the config", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = shell('echo $0')
+    assert_equals('bash', result.stdout)
+
+cli(name="TestShellInterpreter")
+command(name="test", action=test_action)
+`, sindrtest.WithEnv("SINDR_SHELL", "bash -c"))
+	})
+
+	t.Run("doesn't read the interpreter from the config next to the Starlark file", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "sindr.yaml"), []byte("shell: [bash, -c]\n"), 0o600))
+		sindrtest.Test(t, `
+cli(name="TestShellInterpreter")
+`, sindrtest.WithDirectory(dir), sindrtest.ShouldFailWith("can't set shell, it's only read from the user config"))
+
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "sindr.yaml"), []byte("output: grouped\n"), 0o600))
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = shell('echo $0')
+    assert_equals('sh', result.stdout)
+
+cli(name="TestShellInterpreter")
+command(name="test", action=test_action)
+`, sindrtest.WithDirectory(dir))
+	})
+
+	t.Run("interpreter on the call takes precedence", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = shell('echo $0', interpreter=['sh', '-c'])
+    assert_equals('sh', result.stdout)
+
+cli(name="TestShellInterpreter", shell=["bash", "-c"])
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("pipefail is honoured", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = shell('false | true')
+    assert_true(result.success)
+    result = shell('false | true', interpreter=['bash', '-o', 'pipefail', '-c'])
+    assert_false(result.success)
+
+cli(name="TestShellInterpreter")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("fails on an empty interpreter", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    shell('echo hello', interpreter=[])
+
+cli(name="TestShellInterpreter")
+command(name="test", action=test_action)
+`, sindrtest.ShouldFail())
+	})
+
+	t.Run("fails on an interpreter without the flag to run a command", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    shell('echo hello', interpreter=['bash'])
+
+cli(name="TestShellInterpreter")
+command(name="test", action=test_action)
+`, sindrtest.ShouldFailWith(`"bash" doesn't end with the flag to run a command`))
+
+		sindrtest.Test(t, `
+cli(name="TestShellInterpreter", shell=["bash", "-euo", "pipefail"])
+`, sindrtest.ShouldFailWith(`"bash -euo pipefail" doesn't end with the flag to run a command`))
+
+		sindrtest.Test(t, `
+cli(name="TestShellInterpreter")
+`, sindrtest.WithEnv("SINDR_SHELL", "bash"), sindrtest.ShouldFailWith("shell: "))
+	})
+}
+
+func TestShellRedirection(t *testing.T) {
+	t.Run("passes stdin to the command", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = shell('cat', stdin='SELECT 1;')
+    assert_equals('SELECT 1;', result.stdout)
+    result = shell('wc -c', stdin=b'four')
+    assert_equals('4', result.stdout.strip())
+
+cli(name="TestShellRedirection")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("reads stdin from a file", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    shell('printf "from file" > input.txt')
+    result = shell('cat', stdin_file='input.txt')
+    assert_equals('from file', result.stdout)
+
+cli(name="TestShellRedirection")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("redirects output to files", func(t *testing.T) {
+		writer := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = shell('echo out && echo err >&2', stdout_file='out.log', stderr_file='err.log')
+    assert_equals('out', result.stdout)
+    assert_equals('err', result.stderr)
+    assert_equals('out', shell('cat out.log').stdout)
+    assert_equals('err', shell('cat err.log').stdout)
+
+cli(name="TestShellRedirection")
+command(name="test", action=test_action)
+`, sindrtest.WithWriter(writer))
+		assert.Contains(t, loggedAt(writer, "test.star:3:19"), "out")
+	})
+
+	t.Run("tee=False writes output to files without logging it", func(t *testing.T) {
+		writer := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = shell('echo out && echo err >&2', stdout_file='out.log', stderr_file='err.log', tee=False)
+    assert_equals('out', result.stdout)
+    assert_equals('err', result.stderr)
+    assert_equals('out', shell('cat out.log').stdout)
+    assert_equals('err', shell('cat err.log').stdout)
+
+cli(name="TestShellRedirection")
+command(name="test", action=test_action)
+`, sindrtest.WithWriter(writer))
+		assert.NotContains(t, loggedAt(writer, "test.star:3:19"), "out")
+	})
+
+	t.Run("works with run and exec", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    assert_equals('via run', run(['cat'], stdin='via run').stdout)
+    assert_equals('via exec', exec('sh', 'cat', stdin='via exec').stdout)
+    run(['echo', 'archived'], stdout_file='run.log')
+    assert_equals('archived', shell('cat run.log').stdout)
+
+cli(name="TestShellRedirection")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("fails when both stdin and stdin_file are given", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    shell('cat', stdin='a', stdin_file='b')
+
+cli(name="TestShellRedirection")
+command(name="test", action=test_action)
+`, sindrtest.ShouldFail())
+	})
+}
+
+func TestShellResult(t *testing.T) {
+	t.Run("exposes the command, pid and duration", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = shell('sleep 0.05 && echo {{.name}}', name='templated')
+    assert_equals('sleep 0.05 && echo templated', result.command)
+    assert_true(result.pid > 0)
+    assert_true(result.duration >= 50)
+
+    result = run(['echo', 'a b'])
+    assert_equals("echo 'a b'", result.command)
+
+cli(name="TestShellResult")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("splits stdout into lines", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    assert_equals(['a', 'b', 'c'], shell('printf "a\\nb\\nc\\n"').lines)
+    assert_equals([], shell('true').lines)
+
+cli(name="TestShellResult")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("parses stdout as json", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = shell('echo \'{"name": "sindr", "tags": ["a", "b"], "count": 2}\'')
+    parsed = result.json()
+    assert_equals('sindr', parsed['name'])
+    assert_equals(['a', 'b'], parsed['tags'])
+    assert_equals(2, parsed['count'])
+
+cli(name="TestShellResult")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("parses several json values as a list", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    result = shell('printf \'{"name": "a"}\\n{"name": "b"}\\n\'')
+    assert_equals([{'name': 'a'}, {'name': 'b'}], result.json())
+
+cli(name="TestShellResult")
+command(name="test", action=test_action)
+`)
+	})
+
+	t.Run("fails to parse invalid json", func(t *testing.T) {
+		sindrtest.Test(t, `
+def test_action(ctx):
+    shell('echo \'{"name": nope}\'').json()
+
+cli(name="TestShellResult")
+command(name="test", action=test_action)
+`, sindrtest.ShouldFailWith("json: at byte offset 10: invalid character 'o'"))
+
+		sindrtest.Test(t, `
+def test_action(ctx):
+    shell('printf \'{"name": "a"}\\n{"name": x}\'').json()
+
+cli(name="TestShellResult")
+command(name="test", action=test_action)
+`, sindrtest.ShouldFailWith("json: at byte offset 23: invalid character 'x'"))
+	})
+}
+
+// loggedAt returns the lines logged for the call at pos in the Starlark file.
+func loggedAt(writer *sindrtest.CollectWriter, pos string) []string {
+	var lines []string
+	for _, w := range writer.Writes {
+		if rest, ok := strings.CutPrefix(w, pos); ok {
+			lines = append(lines, strings.TrimSpace(rest))
+		}
+	}
+	return lines
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -20,11 +21,18 @@ import (
 type testOptions struct {
 	args           []string
 	fail           bool
+	failWith       string
 	packageJson    map[string]any
 	rawPackageJson string
 	logger         logger.Interface
 	writer         io.Writer
+	output         io.Writer
 	envs           map[string]string
+	eventHandler   func(sindr.Event)
+	cacheDir       string
+	trustCheck     bool
+	dir            string
+	policy         *sindr.Policy
 }
 
 type TestOption func(o *testOptions)
@@ -35,6 +43,14 @@ func ShouldFail() TestOption {
 	}
 }
 
+// ShouldFailWith expects running the Starlark file to fail with an error containing message.
+func ShouldFailWith(message string) TestOption {
+	return func(o *testOptions) {
+		o.fail = true
+		o.failWith = message
+	}
+}
+
 func WithPackageJson(packageJson map[string]any) TestOption {
 	return func(o *testOptions) {
 		o.packageJson = packageJson
@@ -53,6 +69,12 @@ func WithArgs(command ...string) TestOption {
 	}
 }
 
+func WithOutput(output io.Writer) TestOption {
+	return func(o *testOptions) {
+		o.output = output
+	}
+}
+
 func WithLogger(logger logger.Interface) TestOption {
 	return func(o *testOptions) {
 		o.logger = logger
@@ -71,6 +93,40 @@ func WithEnv(k, v string) TestOption {
 	}
 }
 
+// WithCacheDir sets the cache directory, to share the cache between tests.
+func WithCacheDir(dir string) TestOption {
+	return func(o *testOptions) {
+		o.cacheDir = dir
+	}
+}
+
+// WithDirectory sets the directory the Starlark file is written to, to run the same file in several tests.
+func WithDirectory(dir string) TestOption {
+	return func(o *testOptions) {
+		o.dir = dir
+	}
+}
+
+// WithPolicy runs the Starlark file with the policy.
+func WithPolicy(p sindr.Policy) TestOption {
+	return func(o *testOptions) {
+		o.policy = &p
+	}
+}
+
+// WithTrustCheck requires the Starlark file to be trusted to be run, which isn't checked by default.
+func WithTrustCheck() TestOption {
+	return func(o *testOptions) {
+		o.trustCheck = true
+	}
+}
+
+func WithEventHandler(handler func(sindr.Event)) TestOption {
+	return func(o *testOptions) {
+		o.eventHandler = handler
+	}
+}
+
 var fileName = "test.star"
 
 func Test(t *testing.T, contents string, opts ...TestOption) {
@@ -81,7 +137,10 @@ func Test(t *testing.T, contents string, opts ...TestOption) {
 		opt(&options)
 	}
 
-	dir := t.TempDir()
+	dir := options.dir
+	if dir == "" {
+		dir = t.TempDir()
+	}
 
 	err := os.RemoveAll(filepath.Join(dir, fileName))
 	require.NoError(t, err)
@@ -125,6 +184,11 @@ func Test(t *testing.T, contents string, opts ...TestOption) {
 		testWriter = options.writer
 	}
 
+	output := writer
+	if options.output != nil {
+		output = options.output
+	}
+
 	var l logger.Interface = testLogger{T: t, writer: testWriter}
 	if options.logger != nil {
 		l = options.logger
@@ -133,14 +197,20 @@ func Test(t *testing.T, contents string, opts ...TestOption) {
 	for k, v := range options.envs {
 		t.Setenv(k, v)
 	}
-	err = sindr.Run(t.Context(),
-		args,
+	cacheDir := dir + "/cache"
+	if options.cacheDir != "" {
+		cacheDir = options.cacheDir
+	}
+
+	runOpts := []sindr.RunOption{
 		sindr.WithFileName(fileName),
-		sindr.WithCacheDir(dir+"/cache"),
+		sindr.WithCacheDir(cacheDir),
 		sindr.WithDirectory(dir),
 		sindr.WithVerboseLogging(true),
 		sindr.WithLogger(l),
 		sindr.WithWriter(writer),
+		sindr.WithOutput(output),
+		sindr.WithTrustCheck(options.trustCheck),
 		sindr.WithBuiltin("assert_equals", builtinAssertEquals(t, contents)),
 		sindr.WithBuiltin("assert_true", builtinAssertTrue(t, contents)),
 		sindr.WithBuiltin("assert_not_equals", builtinAssertNotEquals(t, contents)),
@@ -149,9 +219,20 @@ func Test(t *testing.T, contents string, opts ...TestOption) {
 		sindr.WithBuiltin("assert_not_empty", builtinAssertNotEmpty(t, contents)),
 		sindr.WithBuiltin("assert_zero", builtinAssertZero(t, contents)),
 		sindr.WithBuiltin("assert_non_zero", builtinAssertNonZero(t, contents)),
-	)
+	}
+	if options.policy != nil {
+		runOpts = append(runOpts, sindr.WithPolicy(*options.policy))
+	}
+	if options.eventHandler != nil {
+		runOpts = append(runOpts, sindr.WithEventHandler(options.eventHandler))
+	}
+
+	err = sindr.Run(t.Context(), args, runOpts...)
 	if options.fail {
 		require.Error(t, err)
+		if options.failWith != "" {
+			require.ErrorContains(t, err, options.failWith)
+		}
 	} else {
 		require.NoError(t, err)
 	}
@@ -162,9 +243,13 @@ var _ io.Writer = (*CollectWriter)(nil)
 type CollectWriter struct {
 	T      *testing.T
 	Writes []string
+
+	mu sync.Mutex
 }
 
 func (c *CollectWriter) Write(p []byte) (n int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.Writes = append(c.Writes, string(p))
 	return len(p), nil
 }
@@ -182,22 +267,26 @@ func (t testLogger) Print(message string) {
 	_, _ = t.writer.Write([]byte(message))
 }
 
+func (t testLogger) Emit(message string) {
+	t.T.Logf("%s", message)
+	_, _ = t.writer.Write([]byte(message + "\n"))
+}
+
 func (t testLogger) WithStack(stack starlark.CallStack) logger.Interface {
 	t.stack = stack
 	return t
 }
 
 func (t testLogger) Log(messages ...string) {
+	message := logger.Redact(strings.Join(messages, " "))
 	if len(t.stack) > 0 {
-		t.T.Logf("%s %s\n", t.stack[0].Pos.String(), strings.Join(messages, " "))
-		_, _ = t.writer.Write(
-			[]byte(fmt.Sprintf("%s %s\n", t.stack[0].Pos.String(), strings.Join(messages, " "))),
-		)
+		t.T.Logf("%s %s\n", t.stack[0].Pos.String(), message)
+		_, _ = t.writer.Write([]byte(fmt.Sprintf("%s %s\n", t.stack[0].Pos.String(), message)))
 		return
 	}
 
-	t.T.Log(strings.Join(messages, " "))
-	_, _ = t.writer.Write([]byte(strings.Join(messages, " ")))
+	t.T.Log(message)
+	_, _ = t.writer.Write([]byte(message))
 }
 
 func (t testLogger) LogErr(message string, err error) {
@@ -208,6 +297,13 @@ func (t testLogger) LogVerbose(messages ...string) {
 	t.Log(messages...)
 }
 
+func (t testLogger) Event(e logger.Event) {
+	lines, _ := logger.Render(e)
+	for _, line := range lines {
+		t.Log(line)
+	}
+}
+
 func withPackageJson(t *testing.T, dir string, data map[string]any) {
 	t.Helper()
 
@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Snapshot is the command tree of a Starlark file, with the hashes of the files it's defined from, so that completion
+// can be served from it without running the Starlark file until any of them change.
+type Snapshot struct {
+	// Files are the hashes of the files the commands are defined from, by their absolute path.
+	Files map[string]string `json:"files"`
+	// Restricted is whether the Starlark file was run without processes, as it wasn't trusted.
+	Restricted bool               `json:"restricted,omitempty"`
+	Command    *CompletionCommand `json:"command"`
+}
+
+type snapshotConfig struct {
+	file       string
+	inputs     []string
+	restricted bool
+}
+
+// SnapshotFile is the file the snapshot of the Starlark file is kept in, in the cache directory.
+func SnapshotFile(cacheDir, file string) string {
+	sum := sha256.Sum256([]byte(file))
+	return filepath.Join(cacheDir, "snapshots", hex.EncodeToString(sum[:8])+".json")
+}
+
+// LoadSnapshot reads the snapshot in file, returning false if there is none or if it isn't fresh: when a file it's
+// defined from has changed, or it was taken when the Starlark file was restricted and now isn't.
+func LoadSnapshot(file string, restricted bool) (*Snapshot, bool) {
+	b, err := os.ReadFile(file) // #nosec G304
+	if err != nil {
+		return nil, false
+	}
+
+	var s Snapshot
+	if err := json.Unmarshal(b, &s); err != nil || s.Command == nil || len(s.Files) == 0 {
+		return nil, false
+	}
+	if s.Restricted && !restricted {
+		return nil, false
+	}
+	for path, hash := range s.Files {
+		if h, err := hashFile(path); err != nil || h != hash {
+			return nil, false
+		}
+	}
+	return &s, true
+}
+
+// SetSnapshot makes the session write the snapshot to file when completing, defined from the inputs.
+func (s *CompletionSession) SetSnapshot(file string, inputs []string, restricted bool) {
+	s.snapshot = snapshotConfig{file: file, inputs: inputs, restricted: restricted}
+}
+
+// saveSnapshot writes the snapshot of the command tree, if the session has one.
+func (s *CompletionSession) saveSnapshot(cmd *CompletionCommand) error {
+	if s.snapshot.file == "" {
+		return nil
+	}
+
+	snapshot := Snapshot{Files: make(map[string]string), Restricted: s.snapshot.restricted, Command: cmd}
+	for _, path := range s.snapshot.inputs {
+		hash, err := hashFile(path)
+		if err != nil {
+			return fmt.Errorf("snapshot: %w", err)
+		}
+		snapshot.Files[path] = hash
+	}
+
+	b, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("marshal snapshot: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.snapshot.file), 0o700); err != nil {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+	if err := os.WriteFile(s.snapshot.file, b, 0o600); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	return nil
+}
+
+// CompleteFromSnapshot completes args, as given to __complete, from the snapshot in file without running the Starlark
+// file. It returns false if the snapshot isn't fresh, or if completing needs to call a function in the Starlark file.
+func CompleteFromSnapshot(file string, restricted bool, args []string, session *CompletionSession) (bool, error) {
+	snapshot, ok := LoadSnapshot(file, restricted)
+	if !ok {
+		return false, nil
+	}
+
+	comps := complete(snapshot.Command, args, session)
+	if session.uncached {
+		session.uncached = false
+		return false, nil
+	}
+
+	printCompletions(comps)
+	return true, session.save()
+}
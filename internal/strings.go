@@ -89,6 +89,8 @@ func toGoValue(value starlark.Value) (any, error) {
 	switch val := value.(type) {
 	case starlark.String:
 		return string(val), nil
+	case Secret:
+		return string(val), nil
 	case starlark.Bool:
 		return bool(val), nil
 	case starlark.Int:
@@ -0,0 +1,157 @@
+// Package trace records what sindr spends its time on as spans, which are written in the Chrome trace event format to
+// be viewed in chrome://tracing or https://ui.perfetto.dev.
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.starlark.net/starlark"
+
+	"github.com/mbark/sindr/internal/logger"
+)
+
+// Default is the tracer spans are recorded with, which is nil unless tracing is enabled.
+var Default *Tracer
+
+// laneKey is the thread local holding the lane a thread's spans are shown in.
+const laneKey = "trace_lane"
+
+// Tracer records spans, showing the spans of each Starlark thread in a lane of its own so that work running in
+// parallel is shown side by side.
+type Tracer struct {
+	mu     sync.Mutex
+	start  time.Time
+	events []event
+	lanes  int
+}
+
+// event is a trace event, see https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU.
+type event struct {
+	Name     string `json:"name"`
+	Category string `json:"cat,omitempty"`
+	Phase    string `json:"ph"`
+	// Timestamp and Duration are in microseconds.
+	Timestamp float64        `json:"ts"`
+	Duration  float64        `json:"dur,omitempty"`
+	Pid       int            `json:"pid"`
+	Tid       int            `json:"tid"`
+	Args      map[string]any `json:"args,omitempty"`
+}
+
+// New creates a tracer, with the time of the spans relative to now.
+func New() *Tracer {
+	return &Tracer{start: time.Now()}
+}
+
+// Span is something being traced, which is recorded when it ends.
+type Span struct {
+	tracer   *Tracer
+	lane     int
+	name     string
+	category string
+	start    time.Time
+	args     map[string]any
+}
+
+// Begin starts a span in the lane of the thread. It returns nil if tracing isn't enabled, which is safe to end.
+func Begin(thread *starlark.Thread, category, name string) *Span {
+	t := Default
+	if t == nil {
+		return nil
+	}
+
+	return &Span{
+		tracer:   t,
+		lane:     t.lane(thread),
+		name:     name,
+		category: category,
+		start:    time.Now(),
+		args:     map[string]any{"thread": thread.Name, "goroutine": goroutineID()},
+	}
+}
+
+// End records the span, with args describing how it went.
+func (s *Span) End(args map[string]any) {
+	if s == nil {
+		return
+	}
+
+	end := time.Now()
+	maps.Copy(s.args, args)
+
+	t := s.tracer
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, event{
+		Name:      s.name,
+		Category:  s.category,
+		Phase:     "X",
+		Timestamp: t.micros(s.start),
+		Duration:  float64(end.Sub(s.start)) / float64(time.Microsecond),
+		Pid:       1,
+		Tid:       s.lane,
+		Args:      s.args,
+	})
+}
+
+func (t *Tracer) lane(thread *starlark.Thread) int {
+	if lane, ok := thread.Local(laneKey).(int); ok {
+		return lane
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lanes++
+	lane := t.lanes
+	thread.SetLocal(laneKey, lane)
+	t.events = append(t.events, event{
+		Name:  "thread_name",
+		Phase: "M",
+		Pid:   1,
+		Tid:   lane,
+		Args:  map[string]any{"name": fmt.Sprintf("%s %d", thread.Name, lane)},
+	})
+	return lane
+}
+
+func (t *Tracer) micros(at time.Time) float64 {
+	return float64(at.Sub(t.start)) / float64(time.Microsecond)
+}
+
+// WriteFile writes the spans recorded to path, in the Chrome trace event format.
+func (t *Tracer) WriteFile(path string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b, err := json.Marshal(map[string]any{"traceEvents": t.events, "displayTimeUnit": "ms"})
+	if err != nil {
+		return fmt.Errorf("marshal trace: %w", err)
+	}
+	// the commands run can contain secrets
+	if err := os.WriteFile(path, []byte(logger.Redact(string(b))), 0o600); err != nil {
+		return fmt.Errorf("write trace: %w", err)
+	}
+	return nil
+}
+
+// goroutineID returns the id of the current goroutine, which Go only exposes in stack traces.
+func goroutineID() uint64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	// the stack starts with "goroutine 1 [running]:"
+	fields := bytes.Fields(buf[:n])
+	if len(fields) < 2 {
+		return 0
+	}
+
+	id, _ := strconv.ParseUint(string(fields[1]), 10, 64)
+	return id
+}
@@ -0,0 +1,105 @@
+package trace_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mbark/sindr/internal/sindrtest"
+)
+
+type traceEvent struct {
+	Name     string         `json:"name"`
+	Category string         `json:"cat"`
+	Phase    string         `json:"ph"`
+	Tid      int            `json:"tid"`
+	Ts       float64        `json:"ts"`
+	Dur      float64        `json:"dur"`
+	Args     map[string]any `json:"args"`
+}
+
+func TestTrace(t *testing.T) {
+	t.Run("writes a span for everything run", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "trace.json")
+		sindrtest.Test(t, `
+def lint():
+    shell('sleep 0.1')
+
+def unit():
+    run(['sleep', '0.1'])
+
+def test_action(ctx):
+    p = pool()
+    p.run(lint)
+    p.run(unit)
+    p.wait()
+    c = cache()
+    c.diff(name='version', version='1')
+
+cli(name="TestTrace")
+command(name="test", action=test_action)
+`, sindrtest.WithArgs("--trace", file, "test"))
+
+		b, err := os.ReadFile(file)
+		require.NoError(t, err)
+		var trace struct {
+			TraceEvents []traceEvent `json:"traceEvents"`
+		}
+		require.NoError(t, json.Unmarshal(b, &trace))
+
+		spans := make(map[string]traceEvent)
+		lanes := make(map[int]string)
+		for _, e := range trace.TraceEvents {
+			switch e.Phase {
+			case "X":
+				spans[e.Category+" "+e.Name] = e
+				assert.NotZero(t, e.Args["goroutine"], e.Name)
+				assert.NotEmpty(t, e.Args["thread"], e.Name)
+			case "M":
+				lanes[e.Tid] = e.Args["name"].(string)
+			}
+		}
+
+		require.Contains(t, spans, "command test")
+		require.Contains(t, spans, "task lint")
+		require.Contains(t, spans, "task unit")
+		require.Contains(t, spans, "shell sleep 0.1")
+		require.Contains(t, spans, "run sleep 0.1")
+		require.Contains(t, spans, "cache version")
+		assert.Equal(t, false, spans["cache version"].Args["hit"])
+
+		// the tasks run in parallel, in lanes of their own
+		lint, unit := spans["task lint"], spans["task unit"]
+		assert.NotEqual(t, lint.Tid, unit.Tid)
+		assert.NotEqual(t, spans["command test"].Tid, lint.Tid)
+		assert.Less(t, lint.Ts, unit.Ts+unit.Dur)
+		assert.Less(t, unit.Ts, lint.Ts+lint.Dur)
+		assert.Equal(t, lint.Tid, spans["shell sleep 0.1"].Tid)
+		assert.Len(t, lanes, 3)
+	})
+
+	t.Run("traces loaded files", func(t *testing.T) {
+		dir := t.TempDir()
+		file := filepath.Join(dir, "trace.json")
+		lib := filepath.Join(dir, "lib.star")
+		require.NoError(t, os.WriteFile(lib, []byte("value = 1\n"), 0o600))
+
+		sindrtest.Test(t, `
+load('`+lib+`', 'value')
+
+def test_action(ctx):
+    assert_equals(1, value)
+
+cli(name="TestTrace")
+command(name="test", action=test_action)
+`, sindrtest.WithArgs("--trace", file, "test"))
+
+		b, err := os.ReadFile(file)
+		require.NoError(t, err)
+		assert.Contains(t, string(b), `"name":"`+lib+`","cat":"load"`)
+	})
+}
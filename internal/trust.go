@@ -0,0 +1,298 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/charmbracelet/x/term"
+	"github.com/urfave/cli/v3"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+
+	"github.com/mbark/sindr/internal/logger"
+	"github.com/mbark/sindr/internal/policy"
+)
+
+var trustStyle = lipgloss.NewStyle().Foreground(lipgloss.ANSIColor(ansi.Yellow)).Bold(true)
+
+// TrustStatus is whether a Starlark file is trusted to be run.
+type TrustStatus int
+
+const (
+	// TrustUnknown is for files that haven't been allowed or denied.
+	TrustUnknown TrustStatus = iota
+	// TrustChanged is for files that were allowed, but have changed since.
+	TrustChanged
+	TrustAllowed
+	TrustDenied
+)
+
+// TrustFile is the file the trusted Starlark files are stored in, in the data directory.
+func TrustFile(dataDir string) string {
+	return filepath.Join(dataDir, "trust.json")
+}
+
+// TrustStore keeps track of the Starlark files that are trusted, by their path and the hash of their contents and of
+// the modules they load, so that a file needs to be allowed again once any of them has changed.
+type TrustStore struct {
+	file  string
+	files map[string]trustEntry
+}
+
+type trustEntry struct {
+	SHA256 string `json:"sha256"`
+	// Modules are the hashes of the files loaded with load(), by their absolute path.
+	Modules map[string]string `json:"modules,omitempty"`
+	Allowed bool              `json:"allowed"`
+}
+
+// LoadTrustStore reads the trust store in file, which is empty if the file doesn't exist.
+func LoadTrustStore(file string) (*TrustStore, error) {
+	s := &TrustStore{file: file, files: make(map[string]trustEntry)}
+
+	b, err := os.ReadFile(file) // #nosec G304
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read trust store: %w", err)
+	}
+	if err := json.Unmarshal(b, &s.files); err != nil {
+		return nil, fmt.Errorf("read trust store %s: %w", file, err)
+	}
+	return s, nil
+}
+
+// Status returns whether the Starlark file at path is trusted.
+func (s *TrustStore) Status(path string) (TrustStatus, error) {
+	entry, ok := s.files[path]
+	if !ok {
+		return TrustUnknown, nil
+	}
+	if !entry.Allowed {
+		return TrustDenied, nil
+	}
+
+	hash, modules, err := trustHashes(path)
+	if err != nil {
+		return TrustUnknown, err
+	}
+	if hash != entry.SHA256 || !maps.Equal(modules, entry.Modules) {
+		return TrustChanged, nil
+	}
+	return TrustAllowed, nil
+}
+
+// Allow trusts the Starlark file at path, as long as it isn't changed.
+func (s *TrustStore) Allow(path string) error {
+	return s.set(path, true)
+}
+
+// Deny stops trusting the Starlark file at path, whether or not it's changed.
+func (s *TrustStore) Deny(path string) error {
+	return s.set(path, false)
+}
+
+func (s *TrustStore) set(path string, allowed bool) error {
+	hash, modules, err := trustHashes(path)
+	if err != nil {
+		return err
+	}
+	s.files[path] = trustEntry{SHA256: hash, Modules: modules, Allowed: allowed}
+
+	b, err := json.MarshalIndent(s.files, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal trust store: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.file), 0o700); err != nil {
+		return fmt.Errorf("trust store: %w", err)
+	}
+	if err := os.WriteFile(s.file, b, 0o600); err != nil {
+		return fmt.Errorf("write trust store: %w", err)
+	}
+	return nil
+}
+
+// trustHashes returns the hash of the Starlark file at path and those of the modules it loads. The modules are found
+// from the load statements, so that they are known before anything is run.
+func trustHashes(path string) (string, map[string]string, error) {
+	hash, err := hashFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	modules := make(map[string]string)
+	addModules(path, filepath.Dir(path), modules)
+	return hash, modules, nil
+}
+
+// addModules adds the hashes of the modules loaded by file, and the ones loaded by them in turn, to modules. Modules
+// are loaded relative to dir. Files that can't be read or parsed are skipped, as loading them fails anyway.
+func addModules(file, dir string, modules map[string]string) {
+	f, err := (&syntax.FileOptions{}).Parse(file, nil, 0)
+	if err != nil {
+		return
+	}
+
+	for _, stmt := range f.Stmts {
+		load, ok := stmt.(*syntax.LoadStmt)
+		if !ok {
+			continue
+		}
+
+		module := load.ModuleName()
+		if !filepath.IsAbs(module) {
+			module = filepath.Join(dir, module)
+		}
+		if _, ok := modules[module]; ok {
+			continue
+		}
+		hash, err := hashFile(module)
+		if err != nil {
+			continue
+		}
+		modules[module] = hash
+		addModules(module, dir, modules)
+	}
+}
+
+func hashFile(path string) (string, error) {
+	b, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", path, err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// IsCompletion returns whether sindr is run with args to complete the command line, which happens as the user types
+// and so can't prompt.
+func IsCompletion(args []string) bool {
+	return (len(args) > 1 && args[1] == "__complete") || slices.Contains(args, "--generate-shell-completion")
+}
+
+// IsHelp returns whether sindr is run to show the help, either without a command or with --help. Parsed are the args
+// left after parsing the flags of sindr.
+func IsHelp(parsed, args []string) bool {
+	return len(parsed) <= 1 || parsed[1] == "help" || slices.Contains(args, "--help") || slices.Contains(args, "-h")
+}
+
+// CheckTrust checks that the Starlark file at path can be run, prompting the user whether to trust it if it isn't
+// known. When only listing the commands, to complete or show the help, files that aren't trusted are run in restricted
+// mode instead, without processes.
+func CheckTrust(store *TrustStore, path string, listing bool) (restricted bool, err error) {
+	status, err := store.Status(path)
+	if err != nil {
+		return false, err
+	}
+
+	switch {
+	case status == TrustAllowed:
+		return false, nil
+	case listing:
+		return true, nil
+	case status == TrustDenied:
+		return false, fmt.Errorf("%s is denied, run 'sindr allow' to trust it", path)
+	}
+
+	reason := "isn't trusted"
+	if status == TrustChanged {
+		reason = "has changed since it was allowed"
+	}
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		return false, fmt.Errorf("%s %s, run 'sindr allow' to trust it", path, reason)
+	}
+
+	_, _ = fmt.Fprintf(logger.Writer, "%s %s. Trust it and run it? [y/N] ", trustStyle.Render(path), reason)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false, fmt.Errorf("%s %s", path, reason)
+	}
+	if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+		return false, fmt.Errorf("%s %s, run 'sindr allow' to trust it", path, reason)
+	}
+	return false, store.Allow(path)
+}
+
+// RestrictProcesses replaces the builtins that start processes, the ones in the process group of policies, with ones
+// failing, for Starlark files that aren't trusted.
+func RestrictProcesses(predeclared starlark.StringDict, path string) {
+	for _, name := range policy.GroupBuiltins[policy.Process] {
+		predeclared[name] = starlark.NewBuiltin(name, func(
+			thread *starlark.Thread,
+			fn *starlark.Builtin,
+			args starlark.Tuple,
+			kwargs []starlark.Tuple,
+		) (starlark.Value, error) {
+			return nil, fmt.Errorf("%s: not allowed as %s isn't trusted, run 'sindr allow' to trust it", name, path)
+		})
+	}
+}
+
+// TrustAction returns the trust command args are for, allow or deny, if any. They are handled before the Starlark
+// file is run, as it's not yet known whether it can be.
+func TrustAction(args []string) string {
+	if len(args) > 1 && (args[1] == "allow" || args[1] == "deny") {
+		return args[1]
+	}
+	return ""
+}
+
+// RunTrustAction allows or denies the Starlark file given in args, or the one at path if none is given. Paths given
+// are relative to cwd.
+func RunTrustAction(store *TrustStore, action string, args []string, path, cwd string) error {
+	if len(args) > 2 {
+		path = args[2]
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(cwd, path)
+		}
+	}
+
+	if action == "deny" {
+		if err := store.Deny(path); err != nil {
+			return err
+		}
+		logger.Log(trustStyle.Render("denied") + " " + path)
+		return nil
+	}
+
+	if err := store.Allow(path); err != nil {
+		return err
+	}
+	logger.Log(trustStyle.Render("allowed") + " " + path)
+	return nil
+}
+
+// TrustCommands creates the allow and deny commands, which are handled before the Starlark file is run, so they are
+// only there for their help.
+func TrustCommands() []*cli.Command {
+	action := func(ctx context.Context, command *cli.Command) error {
+		return fmt.Errorf("%s must be given before any other command", command.Name)
+	}
+	return []*cli.Command{
+		{
+			Name:      "allow",
+			Usage:     "Trusts the Starlark file to be run, until it's changed",
+			ArgsUsage: "[file]",
+			Action:    action,
+		},
+		{
+			Name:      "deny",
+			Usage:     "Stops trusting the Starlark file to be run",
+			ArgsUsage: "[file]",
+			Action:    action,
+		},
+	}
+}
@@ -0,0 +1,104 @@
+package internal_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mbark/sindr/internal/sindrtest"
+)
+
+func TestTrust(t *testing.T) {
+	script := `
+def test_action(ctx):
+    shell('echo ran')
+
+cli(name="TestTrust")
+command(name="test", action=test_action)
+`
+
+	t.Run("refuses to run files that aren't trusted", func(t *testing.T) {
+		dataDir := t.TempDir()
+		sindrtest.Test(t, script, sindrtest.WithTrustCheck(), sindrtest.WithEnv("XDG_DATA_HOME", dataDir),
+			sindrtest.ShouldFail())
+	})
+
+	t.Run("runs files once allowed until they change", func(t *testing.T) {
+		dataDir, dir := t.TempDir(), t.TempDir()
+		sindrtest.Test(t, script, sindrtest.WithTrustCheck(), sindrtest.WithEnv("XDG_DATA_HOME", dataDir),
+			sindrtest.WithDirectory(dir), sindrtest.WithArgs("allow"))
+		assert.FileExists(t, filepath.Join(dataDir, "sindr", "trust.json"))
+
+		sindrtest.Test(t, script, sindrtest.WithTrustCheck(), sindrtest.WithEnv("XDG_DATA_HOME", dataDir),
+			sindrtest.WithDirectory(dir))
+		sindrtest.Test(t, script+"\n# changed\n", sindrtest.WithTrustCheck(),
+			sindrtest.WithEnv("XDG_DATA_HOME", dataDir), sindrtest.WithDirectory(dir), sindrtest.ShouldFail())
+	})
+
+	t.Run("refuses to run files once a module they load changes", func(t *testing.T) {
+		dataDir, dir := t.TempDir(), t.TempDir()
+		module := filepath.Join(dir, "lib.star")
+		require.NoError(t, os.WriteFile(module, []byte("message = 'ran'\n"), 0o600))
+		script := `
+load('lib.star', 'message')
+
+def test_action(ctx):
+    shell('echo ' + message)
+
+cli(name="TestTrust")
+command(name="test", action=test_action)
+`
+		trusted := func(opts ...sindrtest.TestOption) {
+			sindrtest.Test(t, script, append([]sindrtest.TestOption{sindrtest.WithTrustCheck(),
+				sindrtest.WithEnv("XDG_DATA_HOME", dataDir), sindrtest.WithDirectory(dir)}, opts...)...)
+		}
+		trusted(sindrtest.WithArgs("allow"))
+		trusted()
+
+		require.NoError(t, os.WriteFile(module, []byte("message = 'changed'\n"), 0o600))
+		trusted(sindrtest.ShouldFailWith("has changed since it was allowed"))
+	})
+
+	t.Run("refuses to run files that are denied", func(t *testing.T) {
+		dataDir, dir := t.TempDir(), t.TempDir()
+		trusted := func(opts ...sindrtest.TestOption) {
+			sindrtest.Test(t, script, append([]sindrtest.TestOption{sindrtest.WithTrustCheck(),
+				sindrtest.WithEnv("XDG_DATA_HOME", dataDir), sindrtest.WithDirectory(dir)}, opts...)...)
+		}
+		trusted(sindrtest.WithArgs("allow"))
+		trusted(sindrtest.WithArgs("deny"))
+		trusted(sindrtest.ShouldFail())
+	})
+
+	t.Run("shows the help without starting processes for files that aren't trusted", func(t *testing.T) {
+		dataDir := t.TempDir()
+		output := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, script, sindrtest.WithTrustCheck(), sindrtest.WithEnv("XDG_DATA_HOME", dataDir),
+			sindrtest.WithArgs("--help"), sindrtest.WithOutput(output))
+		assert.Contains(t, strings.Join(output.Writes, ""), "test")
+
+		sindrtest.Test(t, script, sindrtest.WithTrustCheck(), sindrtest.WithEnv("XDG_DATA_HOME", dataDir),
+			sindrtest.WithArgs("--verbose"), sindrtest.WithOutput(new(sindrtest.CollectWriter)))
+	})
+
+	t.Run("completes without starting processes for files that aren't trusted", func(t *testing.T) {
+		dataDir := t.TempDir()
+		writer := new(sindrtest.CollectWriter)
+		sindrtest.Test(t, script, sindrtest.WithTrustCheck(), sindrtest.WithEnv("XDG_DATA_HOME", dataDir),
+			sindrtest.WithArgs("__complete"), sindrtest.WithWriter(writer))
+		assert.Contains(t, writer.Writes, "test\n")
+
+		marker := filepath.Join(t.TempDir(), "marker")
+		sindrtest.Test(t, `
+shell('touch `+marker+`')
+cli(name="TestTrust")
+`, sindrtest.WithTrustCheck(), sindrtest.WithEnv("XDG_DATA_HOME", dataDir), sindrtest.WithArgs("__complete"),
+			sindrtest.ShouldFail())
+		_, err := os.Stat(marker)
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
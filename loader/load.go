@@ -10,6 +10,8 @@ import (
 	"go.starlark.net/syntax"
 
 	"github.com/mbark/sindr/internal/logger"
+	"github.com/mbark/sindr/internal/policy"
+	"github.com/mbark/sindr/internal/trace"
 )
 
 // Code taken from https://github.com/google/starlark-go/blob/master/starlark/example_test.go
@@ -19,8 +21,28 @@ var (
 	entryCache  = make(map[string]*entry)
 )
 
-func Load(_ *starlark.Thread, module string) (starlark.StringDict, error) {
+// Loaded returns the modules that have been loaded.
+func Loaded() []string {
+	modules := make([]string, 0, len(entryCache))
+	for module := range entryCache {
+		modules = append(modules, module)
+	}
+	return modules
+}
+
+// Reset forgets the modules that have been loaded, so that they are loaded again.
+func Reset() {
+	entryCache = make(map[string]*entry)
+}
+
+func Load(t *starlark.Thread, module string) (starlark.StringDict, error) {
+	if err := policy.CheckPath(t, "load", module, false); err != nil {
+		return nil, err
+	}
+	span := trace.Begin(t, "load", module)
 	e, ok := entryCache[module]
+	cached := e != nil
+	defer func() { span.End(map[string]any{"cached": cached}) }()
 	if e == nil {
 		if ok {
 			// request for package whose loading is in progress
@@ -0,0 +1,60 @@
+package sindr
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/mbark/sindr/internal/policy"
+)
+
+// Policy restricts what the Starlark file can do, by allowing or denying groups of builtins and limiting the files it
+// can access to a set of roots. Builtins that aren't allowed fail with an error naming them and where they were called.
+type Policy = policy.Policy
+
+// The groups of builtins a Policy can allow or deny.
+const (
+	// PolicyProcess is for builtins starting processes, like shell() and service().
+	PolicyProcess = policy.Process
+	// PolicyNetwork is for builtins making network requests, like the readiness checks of services.
+	PolicyNetwork = policy.Network
+	// PolicyFSWrite is for builtins writing files, like shell(..., stdout_file=...).
+	PolicyFSWrite = policy.FSWrite
+	// PolicyEnv is for builtins changing the environment variables of sindr, like dotenv().
+	PolicyEnv = policy.Env
+)
+
+// WithPolicy sets the policy the Starlark file is run with, instead of the one in the config.
+func WithPolicy(p Policy) RunOption {
+	return func(o *runOptions, v *viper.Viper) {
+		o.policy = &p
+	}
+}
+
+// readPolicy reads the policy from the user config and the SINDR_POLICY_ALLOW, SINDR_POLICY_DENY and
+// SINDR_POLICY_ROOTS environment variables. The config next to the Starlark file can't set a policy, as the files the
+// policy is meant to restrict could then turn it off.
+func readPolicy() (*Policy, error) {
+	u := viper.New()
+	u.SetConfigName("sindr")
+	u.AddConfigPath(xdgPath("CONFIG_HOME", path.Join(os.Getenv("HOME"), ".config")))
+	if err := u.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if !errors.As(err, &notFound) {
+			return nil, fmt.Errorf("read config: %w", err)
+		}
+	}
+	u.SetEnvPrefix("SINDR")
+	u.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	u.AutomaticEnv()
+
+	return &Policy{
+		Allow: u.GetStringSlice(policyKey + ".allow"),
+		Deny:  u.GetStringSlice(policyKey + ".deny"),
+		Roots: u.GetStringSlice(policyKey + ".roots"),
+	}, nil
+}
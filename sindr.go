@@ -7,6 +7,8 @@ import (
 	"io"
 	"os"
 	"path"
+	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 
@@ -20,6 +22,8 @@ import (
 	"github.com/mbark/sindr/cache"
 	"github.com/mbark/sindr/internal"
 	"github.com/mbark/sindr/internal/logger"
+	"github.com/mbark/sindr/internal/policy"
+	"github.com/mbark/sindr/internal/trace"
 	"github.com/mbark/sindr/loader"
 )
 
@@ -32,6 +36,11 @@ type runOptions struct {
 	directory string
 	logger    logger.Interface
 	writer    io.Writer
+	output    io.Writer
+
+	eventHandlers []func(Event)
+	trustCheck    bool
+	policy        *Policy
 }
 
 var (
@@ -40,6 +49,16 @@ var (
 	verboseKey     = "verbose"
 	noCacheKey     = "no_cache"
 	lineNumbersKey = "line_numbers"
+	shellKey       = "shell"
+	secretsKeyKey  = "secrets_key_file"
+	policyKey      = "policy"
+	outputKey      = "output"
+	progressKey    = "progress"
+	quietKey       = "quiet"
+	logFormatKey   = "log_format"
+	traceKey       = "trace"
+	reportKey      = "report"
+	ciKey          = "ci"
 )
 
 type RunOption func(o *runOptions, v *viper.Viper)
@@ -56,6 +75,14 @@ func WithWriter(w io.Writer) RunOption {
 	}
 }
 
+// WithOutput sets where data is written, like the output of emit(), as opposed to logs which are written to the
+// writer given with WithWriter.
+func WithOutput(w io.Writer) RunOption {
+	return func(o *runOptions, v *viper.Viper) {
+		o.output = w
+	}
+}
+
 func WithCacheDir(dir string) RunOption {
 	return func(o *runOptions, v *viper.Viper) {
 		v.Set(cacheDirKey, dir)
@@ -92,6 +119,14 @@ func WithNoCache(noCache bool) RunOption {
 	}
 }
 
+// WithTrustCheck sets whether the Starlark file has to be trusted to be run, which isn't checked by default as programs
+// embedding sindr usually run a Starlark file of their own. The sindr command turns it on.
+func WithTrustCheck(check bool) RunOption {
+	return func(o *runOptions, v *viper.Viper) {
+		o.trustCheck = check
+	}
+}
+
 func WithDirectory(directory string) RunOption {
 	return func(o *runOptions, v *viper.Viper) {
 		o.directory = directory
@@ -111,13 +146,37 @@ func flagName(s string) string {
 }
 
 func Run(ctx context.Context, args []string, opts ...RunOption) error {
+	for {
+		err := run(ctx, args, opts...)
+		var rerun *internal.RerunError
+		if !errors.As(err, &rerun) {
+			return err
+		}
+
+		// the invocation is run again once everything of the current one is done
+		logger.Log(internal.RenderRerun(rerun.Entry))
+		if rerun.Entry.Cwd != "" {
+			if err := os.Chdir(rerun.Entry.Cwd); err != nil {
+				return fmt.Errorf("rerun: %w", err)
+			}
+		}
+		args = append([]string{args[0]}, rerun.Entry.Args...)
+	}
+}
+
+func run(ctx context.Context, args []string, opts ...RunOption) (err error) {
+	// the directory sindr is run from, as it changes to the directory of the Starlark file
+	cwd, _ := os.Getwd()
+
 	cacheDir := path.Join(xdgPath("CACHE_HOME", path.Join(os.Getenv("HOME"), ".cache")), "sindr")
+	dataDir := path.Join(xdgPath("DATA_HOME", path.Join(os.Getenv("HOME"), ".local", "share")), "sindr")
 
 	v := viper.New()
 
 	fs := flag.NewFlagSet("sindr", flag.ContinueOnError)
 	fs.Usage = func() {} // unbind the default printing, we let urfave/cli handle this later on
-	fs.BoolP(flagName(verboseKey), "v", false, "print logs to stdout")
+	fs.BoolP(flagName(verboseKey), "v", false, "print verbose logs")
+	fs.BoolP(flagName(quietKey), "q", false, "only print errors and data from emit()")
 	fs.BoolP(flagName(noCacheKey), "n", false, "ignore stored values in the cache")
 	fs.BoolP(
 		flagName(lineNumbersKey),
@@ -127,9 +186,19 @@ func Run(ctx context.Context, args []string, opts ...RunOption) error {
 	)
 	fs.StringP(flagName(fileNameKey), "f", "sindr.star", "path to the Starlark config file")
 	fs.String(flagName(cacheDirKey), cacheDir, "path to the Starlark config file")
+	fs.String(
+		flagName(outputKey),
+		internal.OutputInterleaved,
+		"how to show output of parallel tasks: interleaved, grouped or failed-only",
+	)
+	fs.Bool(flagName(progressKey), false, "show the progress of running tasks")
+	fs.String(flagName(logFormatKey), "text", "how to format logs: text or json")
+	fs.String(flagName(traceKey), "", "write a trace of the run to a file, in the Chrome trace event format")
+	fs.String(flagName(reportKey), "", "write a report of the steps run to a JUnit .xml or a .json file")
+	fs.String(flagName(ciKey), "", "format logs for a CI system: github, gitlab or none, detected if not set")
 	_ = fs.Parse(args) // ignore this error, let urfave/cli deal with it later on
 
-	err := v.BindPFlags(fs)
+	err = v.BindPFlags(fs)
 	if err != nil {
 		return fmt.Errorf("viper bind flags: %w", err)
 	}
@@ -139,10 +208,11 @@ func Run(ctx context.Context, args []string, opts ...RunOption) error {
 		v.Set(strings.ReplaceAll(key, "-", "_"), v.Get(key))
 	}
 
+	v.SetDefault(secretsKeyKey, path.Join(
+		xdgPath("CONFIG_HOME", path.Join(os.Getenv("HOME"), ".config")), "sindr", "secrets.key",
+	))
 	v.SetEnvPrefix("SINDR")
 	v.AutomaticEnv()
-	v.SetConfigFile("sindr")
-	v.AddConfigPath(xdgPath("CONFIG_HOME", path.Join(os.Getenv("HOME"), ".config")))
 
 	options := runOptions{
 		globals: starlark.StringDict{},
@@ -151,18 +221,86 @@ func Run(ctx context.Context, args []string, opts ...RunOption) error {
 		o(&options, v)
 	}
 
-	if options.logger != nil {
+	switch format := v.GetString(logFormatKey); {
+	case options.logger != nil:
 		logger.Default = options.logger
+	case format == "json":
+		logger.Default = logger.JSON{}
+	case format == "text":
+		logger.Default = logger.Logger{}
+	default:
+		return fmt.Errorf("unknown log format %q, expected text or json", format)
+	}
+	ci := v.GetString(ciKey)
+	if ci == "" && options.logger == nil && v.GetString(logFormatKey) == "text" {
+		ci = logger.DetectCI()
+	}
+	switch ci {
+	case "", logger.CINone:
+	case logger.CIGitHub, logger.CIGitLab:
+		logger.Default = logger.NewCI(logger.Default, ci)
+	default:
+		return fmt.Errorf("unknown CI system %q, expected github, gitlab or none", ci)
 	}
 	if options.writer != nil {
 		logger.Writer = options.writer
 	}
-	logger.DoLogVerbose = v.GetBool(verboseKey)
+	if options.output != nil {
+		logger.Output = options.output
+	}
+	report := internal.NewReport()
+	history := internal.NewHistory(args[min(1, len(args)):], cwd)
+	logger.Handlers = append(slices.Clone(options.eventHandlers), report.Handle, history.Handle)
+	// the error is returned for the caller to log, but the handlers are told about it like about any other failure
+	defer func() {
+		var rerun *internal.RerunError
+		if err != nil && !errors.As(err, &rerun) {
+			logger.Notify(logger.NewError("error running sindr", err))
+		}
+	}()
+	logger.ResetSecrets()
+	logger.Quiet = v.GetBool(quietKey)
+	logger.DoLogVerbose = v.GetBool(verboseKey) && !logger.Quiet
 	logger.WithLineNumbers = v.GetBool(lineNumbersKey)
 	cache.GlobalCache.ForceOutOfDate = v.GetBool(noCacheKey)
 
 	cache.SetCache(v.GetString(cacheDirKey))
 
+	historyFile := internal.HistoryFile(v.GetString(cacheDirKey))
+	// "!!" is rerun before the Starlark file is loaded, while rerun is a command that can be defined by it
+	if fs.NArg() > 1 && fs.Arg(1) == "!!" {
+		entry, err := internal.Rerun(historyFile, fs.Args()[2:])
+		if err != nil {
+			return err
+		}
+		return &internal.RerunError{Entry: entry}
+	}
+
+	trace.Default = nil
+	if file := v.GetString(traceKey); file != "" {
+		// the path is relative to where sindr is run, not the directory of the Starlark file
+		file, err = filepath.Abs(file)
+		if err != nil {
+			return fmt.Errorf("trace: %w", err)
+		}
+
+		trace.Default = trace.New()
+		defer func() {
+			err = errors.Join(err, trace.Default.WriteFile(file))
+		}()
+	}
+
+	reportFile := v.GetString(reportKey)
+	if reportFile != "" {
+		if err := internal.ValidateReportFile(reportFile); err != nil {
+			return err
+		}
+		reportFile, err = filepath.Abs(reportFile)
+		if err != nil {
+			return fmt.Errorf("report: %w", err)
+		}
+	}
+
 	dir := options.directory
 	if dir == "" {
 		dir, err = findPathUpdwards(v.GetString(fileNameKey))
@@ -175,21 +313,99 @@ func Run(ctx context.Context, args []string, opts ...RunOption) error {
 		return err
 	}
 
+	v.SetConfigName("sindr")
+	v.AddConfigPath(xdgPath("CONFIG_HOME", path.Join(os.Getenv("HOME"), ".config")))
+	err = v.ReadInConfig()
+	if err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if !errors.As(err, &notFound) {
+			return fmt.Errorf("read config: %w", err)
+		}
+	}
+	err = readProjectConfig(v, dir)
+	if err != nil {
+		return err
+	}
+
+	policy.Default = nil
+	p := options.policy
+	if p == nil {
+		p, err = readPolicy()
+		if err != nil {
+			return err
+		}
+	}
+	if !p.IsZero() {
+		policy.Default, err = policy.New(*p, dir)
+		if err != nil {
+			return err
+		}
+	}
+
 	predeclared := createPredeclaredDict(dir)
 	for name, value := range options.globals {
 		predeclared[name] = value
 	}
+	policy.Wrap(predeclared)
+
+	file, err := filepath.Abs(v.GetString(fileNameKey))
+	if err != nil {
+		return err
+	}
+	trustStore, err := internal.LoadTrustStore(internal.TrustFile(dataDir))
+	if err != nil {
+		return err
+	}
+	if action := internal.TrustAction(fs.Args()); action != "" {
+		return internal.RunTrustAction(trustStore, action, fs.Args(), file, cwd)
+	}
+	var restricted bool
+	if options.trustCheck {
+		listing := internal.IsCompletion(fs.Args()) || internal.IsHelp(fs.Args(), args)
+		restricted, err = internal.CheckTrust(trustStore, file, listing)
+		if err != nil {
+			return err
+		}
+		if restricted {
+			internal.RestrictProcesses(predeclared, file)
+		}
+	}
+
+	// completing is served from the snapshot of the commands when the files they are defined from haven't changed,
+	// without running the Starlark file
+	completion := internal.NewCompletionSession(cwd, v.GetString(cacheDirKey), file)
+	snapshotFile := internal.SnapshotFile(v.GetString(cacheDirKey), file)
+	if len(fs.Args()) > 1 && fs.Args()[1] == "__complete" && !v.GetBool(noCacheKey) {
+		served, err := internal.CompleteFromSnapshot(snapshotFile, restricted, fs.Args()[2:], completion)
+		if served || err != nil {
+			return err
+		}
+	}
 
+	loader.Reset()
 	loader.Predeclared = predeclared
 	thread := &starlark.Thread{
 		Name: "cli",
 		Load: loader.Load,
 		Print: func(thread *starlark.Thread, msg string) {
-			logger.WithStack(thread.CallStack()).Log(msg)
+			internal.GetLogger(thread).Log(msg)
 		},
 	}
 
 	sindrCLI, wg := internal.InitialiseLocals(thread)
+	sindrCLI.Shell = v.GetStringSlice(shellKey)
+	if len(sindrCLI.Shell) > 0 {
+		if err := internal.CheckShell(sindrCLI.Shell); err != nil {
+			return fmt.Errorf("shell: %w", err)
+		}
+	}
+	sindrCLI.Output = v.GetString(outputKey)
+	sindrCLI.SecretsKeyFile = v.GetString(secretsKeyKey)
+	sindrCLI.Progress = internal.NewProgress(logger.Writer, v.GetBool(progressKey) && v.GetString(logFormatKey) != "json")
+	if sindrCLI.Progress.Live() {
+		logger.Writer = sindrCLI.Progress
+	}
+	defer sindrCLI.Progress.Stop()
 	_, err = starlark.ExecFileOptions(
 		&syntax.FileOptions{},
 		thread,
@@ -201,7 +417,39 @@ func Run(ctx context.Context, args []string, opts ...RunOption) error {
 		return err
 	}
 
-	return runCLI(ctx, args, fs, sindrCLI, wg)
+	builtinCommands := append(
+		internal.HistoryCommands(historyFile, cwd),
+		internal.SecretsCommand(sindrCLI.SecretsKeyFile, cwd),
+	)
+	builtinCommands = append(builtinCommands, internal.TrustCommands()...)
+	for _, c := range builtinCommands {
+		// commands defined in the Starlark file take precedence
+		if sindrCLI.Command.Command.Command(c.Name) == nil {
+			sindrCLI.Command.Command.Commands = append(sindrCLI.Command.Command.Commands, c)
+		}
+	}
+
+	inputs := append([]string{file}, sindrCLI.Inputs...)
+	for _, module := range loader.Loaded() {
+		if abs, err := filepath.Abs(module); err == nil {
+			inputs = append(inputs, abs)
+		}
+	}
+	completion.SetSnapshot(snapshotFile, inputs, restricted)
+
+	err = runCLI(ctx, args, fs, sindrCLI, wg, completion)
+	if herr := history.Save(historyFile, err); herr != nil {
+		logger.LogErr("failed to save history", herr)
+	}
+	if v.GetString(logFormatKey) != "json" {
+		for _, line := range report.Summary() {
+			logger.Log(line)
+		}
+	}
+	if reportFile != "" {
+		err = errors.Join(err, report.WriteFile(reportFile))
+	}
+	return err
 }
 
 func runCLI(
@@ -210,6 +458,7 @@ func runCLI(
 	fs *flag.FlagSet,
 	sindrCLI *internal.CLI,
 	wg *sync.WaitGroup,
+	completion *internal.CompletionSession,
 ) error {
 	cliFlags, err := mapPFlagsToCLIFlags(fs)
 	if err != nil {
@@ -223,10 +472,14 @@ func runCLI(
 	cmd.Commands = append(cmd.Commands, &cli.Command{
 		Name:   "__complete",
 		Hidden: true,
-		Usage:  "internal: fish dynamic completion",
-		Action: internal.CompleteAction(cmd),
+		Usage:  "internal: dynamic shell completion",
+		Action: internal.CompleteAction(cmd, completion),
 	})
 
+	stopOnSignal := sindrCLI.StopServicesOnSignal()
+	defer stopOnSignal()
+	defer sindrCLI.StopServices()
+
 	err = cmd.Run(ctx, args)
 	if err != nil {
 		return err
@@ -293,13 +546,22 @@ func createPredeclaredDict(dir string) starlark.StringDict {
 
 		"shell": starlark.NewBuiltin("shell", internal.SindrShell),
 		"exec":  starlark.NewBuiltin("exec", internal.SindrExec),
+		"run":   starlark.NewBuiltin("run", internal.SindrRun),
+		"pipe":  starlark.NewBuiltin("pipe", internal.SindrPipe),
+		"retry": starlark.NewBuiltin("retry", internal.SindrRetry),
 
 		"string": starlark.NewBuiltin("string", internal.SindrString),
+		"secret": starlark.NewBuiltin("secret", internal.SindrSecret),
+		"emit":   starlark.NewBuiltin("emit", internal.SindrEmit),
 
 		"start": starlark.NewBuiltin("start", internal.SindrStart),
 		"wait":  starlark.NewBuiltin("wait", internal.SindrWait),
 		"pool":  starlark.NewBuiltin("pool", internal.SindrPool),
 
+		"service":       starlark.NewBuiltin("service", internal.SindrService),
+		"processes":     starlark.NewBuiltin("processes", internal.SindrProcesses),
+		"load_procfile": starlark.NewBuiltin("load_procfile", internal.SindrLoadProcfile),
+
 		"newest_ts": starlark.NewBuiltin("newest_ts", internal.SindrNewestTS),
 		"oldest_ts": starlark.NewBuiltin("oldest_ts", internal.SindrOldestTS),
 		"glob":      starlark.NewBuiltin("glob", internal.SindrGlob),
@@ -308,7 +570,8 @@ func createPredeclaredDict(dir string) starlark.StringDict {
 			"load_package_json",
 			internal.SindrLoadPackageJson,
 		),
-		"cache":       starlark.NewBuiltin("cache", cache.NewCacheValue),
-		"current_dir": starlark.String(dir),
+		"load_secrets": starlark.NewBuiltin("load_secrets", internal.SindrLoadSecrets),
+		"cache":        starlark.NewBuiltin("cache", cache.NewCacheValue),
+		"current_dir":  starlark.String(dir),
 	}
 }